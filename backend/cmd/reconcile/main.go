@@ -0,0 +1,32 @@
+// Command reconcile recounts the like, comment and reply counters stored on
+// posts and comments and repairs the ones that drifted from the rows they
+// count. It is safe to run while the server is up.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/counters"
+	"github.com/applifylab/social-feed-backend/internal/database"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 1000, "rows recounted per statement")
+	flag.Parse()
+	if *batchSize <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	cfg := config.Load()
+	if err := database.Connect(cfg); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	posts, comments, err := counters.Reconcile(database.DB, *batchSize)
+	if err != nil {
+		log.Fatal("Failed to reconcile counters:", err)
+	}
+	log.Printf("Repaired counters on %d posts and %d comments", posts, comments)
+}
@@ -2,17 +2,36 @@ package main
 
 import (
 	"log"
+	"time"
 
+	"github.com/applifylab/social-feed-backend/internal/auth"
 	"github.com/applifylab/social-feed-backend/internal/config"
 	"github.com/applifylab/social-feed-backend/internal/database"
 	"github.com/applifylab/social-feed-backend/internal/handlers"
+	"github.com/applifylab/social-feed-backend/internal/jobs"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
 	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/oauth"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
+
+	// Load token signing keys
+	if err := auth.LoadKeys(cfg); err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+
+	// Configure the passkey relying party
+	webAuthn, err := auth.NewWebAuthn(cfg)
+	if err != nil {
+		log.Fatal("Invalid passkey configuration:", err)
+	}
 
 	// Connect to database
 	if err := database.Connect(cfg); err != nil {
@@ -24,17 +43,42 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Load revoked tokens into memory
+	if err := auth.LoadRevokedTokens(); err != nil {
+		log.Fatal("Failed to load revoked tokens:", err)
+	}
+
+	mail := mailer.New(cfg)
+
+	// Remove the data of accounts whose deletion grace period has ended
+	jobs.Every("account purge", cfg.AccountPurgeInterval, func() error {
+		return jobs.PurgeDeletedAccounts(cfg)
+	})
+
+	// Build requested data exports
+	jobs.Every("data export", time.Minute, func() error {
+		return jobs.ProcessDataExports(cfg, mail)
+	})
+
 	// Initialize Gin
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
 
 	// Apply CORS middleware
 	router.Use(middleware.CORSMiddleware(cfg))
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(cfg)
+	authHandler := handlers.NewAuthHandler(cfg, mail)
 	postHandler := handlers.NewPostHandler(cfg)
 	commentHandler := handlers.NewCommentHandler(cfg)
 	uploadHandler := handlers.NewUploadHandler(cfg)
+	oauthHandler := handlers.NewOAuthHandler(cfg, oauth.NewRegistry(cfg))
+	adminHandler := handlers.NewAdminHandler(cfg)
+	moderationHandler := handlers.NewModerationHandler(cfg)
+	passkeyHandler := handlers.NewPasskeyHandler(cfg, webAuthn)
+	userHandler := handlers.NewUserHandler(cfg)
 
 	// Public routes
 	api := router.Group("/api")
@@ -44,7 +88,26 @@ func main() {
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/email/confirm", authHandler.ConfirmEmailChange)
+			auth.POST("/account/restore", authHandler.RestoreAccount)
+			auth.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+			auth.POST("/magic-link", authHandler.RequestMagicLink)
+			auth.POST("/magic-link/verify", authHandler.RedeemMagicLink)
+			auth.POST("/passkeys/login/begin", passkeyHandler.BeginLogin)
+			auth.POST("/passkeys/login/finish", passkeyHandler.FinishLogin)
+
+			// Social login
+			auth.GET("/oauth/providers", oauthHandler.ListProviders)
+			auth.GET("/oauth/:provider", oauthHandler.Start)
+			auth.GET("/oauth/:provider/callback", oauthHandler.Callback)
 		}
+
+		// Data export downloads, authorized by the token in the emailed link
+		api.POST("/exports/download", authHandler.DownloadDataExport)
 	}
 
 	// Protected routes
@@ -52,10 +115,65 @@ func main() {
 	protected.Use(middleware.AuthMiddleware(cfg))
 	{
 		// Auth routes
-		protected.GET("/auth/me", authHandler.GetMe)
+		account := protected.Group("/auth")
+		account.Use(middleware.RequireScope("account"), middleware.DenyImpersonatedWrites())
+		{
+			account.GET("/me", authHandler.GetMe)
+			account.POST("/logout", authHandler.Logout)
+			account.POST("/logout-all", authHandler.LogoutAll)
+			account.GET("/sessions", authHandler.GetSessions)
+			account.DELETE("/sessions/:id", authHandler.RevokeSession)
+			account.POST("/verify-email/resend", authHandler.ResendVerification)
+			account.PUT("/password", authHandler.ChangePassword)
+			account.POST("/email", authHandler.ChangeEmail)
+			account.POST("/2fa/setup", authHandler.SetupTwoFactor)
+			account.POST("/2fa/confirm", authHandler.ConfirmTwoFactor)
+			account.POST("/2fa/disable", authHandler.DisableTwoFactor)
+			account.GET("/identities", oauthHandler.ListIdentities)
+			account.DELETE("/identities/:id", oauthHandler.DeleteIdentity)
+			account.POST("/passkeys/register/begin", passkeyHandler.BeginRegistration)
+			account.POST("/passkeys/register/finish", passkeyHandler.FinishRegistration)
+			account.GET("/passkeys", passkeyHandler.ListPasskeys)
+			account.DELETE("/passkeys/:id", passkeyHandler.DeletePasskey)
+			account.POST("/tokens", authHandler.CreateAccessToken)
+			account.GET("/tokens", authHandler.GetAccessTokens)
+			account.DELETE("/tokens/:id", authHandler.DeleteAccessToken)
+			account.DELETE("/account", authHandler.DeleteAccount)
+			account.POST("/exports", authHandler.RequestDataExport)
+			account.GET("/exports", authHandler.GetDataExports)
+		}
+
+		// User profile routes
+		users := protected.Group("/users")
+		users.Use(middleware.RequireScope("users"), middleware.RequireVerifiedEmail(cfg))
+		{
+			users.PUT("/me", userHandler.UpdateMe)
+			users.GET("/me/blocks", userHandler.GetBlocked)
+			users.GET("/me/mutes", userHandler.GetMuted)
+			users.GET("/me/close-friends", userHandler.GetCloseFriends)
+			users.GET("/:handle", userHandler.GetUser)
+			users.POST("/:handle/follow", userHandler.Follow)
+			users.DELETE("/:handle/follow", userHandler.Unfollow)
+			users.GET("/:handle/followers", userHandler.GetFollowers)
+			users.GET("/:handle/following", userHandler.GetFollowing)
+			users.POST("/:handle/block", userHandler.Block)
+			users.DELETE("/:handle/block", userHandler.Unblock)
+			users.POST("/:handle/mute", userHandler.Mute)
+			users.DELETE("/:handle/mute", userHandler.Unmute)
+			users.POST("/:handle/close-friend", userHandler.AddCloseFriend)
+			users.DELETE("/:handle/close-friend", userHandler.RemoveCloseFriend)
+		}
+
+		// Home timeline
+		feed := protected.Group("/feed")
+		feed.Use(middleware.RequireScope("posts"), middleware.RequireVerifiedEmail(cfg))
+		{
+			feed.GET("/home", postHandler.GetHomeFeed)
+		}
 
 		// Post routes
 		posts := protected.Group("/posts")
+		posts.Use(middleware.RequireScope("posts"), middleware.RequireVerifiedEmail(cfg))
 		{
 			posts.POST("", postHandler.CreatePost)
 			posts.GET("", postHandler.GetPosts)
@@ -72,6 +190,7 @@ func main() {
 
 		// Comment routes
 		comments := protected.Group("/comments")
+		comments.Use(middleware.RequireScope("comments"), middleware.RequireVerifiedEmail(cfg))
 		{
 			comments.POST("/:id/replies", commentHandler.CreateReply)
 			comments.GET("/:id/replies", commentHandler.GetReplies)
@@ -81,12 +200,42 @@ func main() {
 		}
 
 		// Upload routes
-		protected.POST("/upload", uploadHandler.UploadImage)
+		protected.POST("/upload", middleware.RequireScope("uploads"), middleware.RequireVerifiedEmail(cfg), uploadHandler.UploadImage)
+
+		// Moderation routes
+		moderation := protected.Group("/moderation")
+		moderation.Use(middleware.RequireScope("moderation"))
+		{
+			moderatePosts := middleware.RequirePermission(auth.PermModeratePosts)
+			moderateComments := middleware.RequirePermission(auth.PermModerateComments)
+			moderation.POST("/posts/:id/hide", moderatePosts, moderationHandler.HidePost)
+			moderation.POST("/posts/:id/unhide", moderatePosts, moderationHandler.UnhidePost)
+			moderation.POST("/comments/:id/hide", moderateComments, moderationHandler.HideComment)
+			moderation.POST("/comments/:id/unhide", moderateComments, moderationHandler.UnhideComment)
+			moderation.GET("/actions", middleware.RequirePermission(auth.PermViewModerationLog), moderationHandler.GetActions)
+		}
+
+		// Admin routes
+		admin := protected.Group("/admin")
+		admin.Use(middleware.RequireScope("admin"))
+		{
+			admin.GET("/failed-logins", middleware.RequirePermission(auth.PermViewLoginAuditLog), adminHandler.GetFailedLogins)
+			admin.PUT("/users/:id/role", middleware.RequirePermission(auth.PermManageRoles), adminHandler.UpdateUserRole)
+
+			impersonate := middleware.RequirePermission(auth.PermImpersonate)
+			admin.POST("/users/:id/impersonate", impersonate, adminHandler.Impersonate)
+			admin.GET("/impersonations", impersonate, adminHandler.GetImpersonations)
+			admin.GET("/impersonations/:id/requests", impersonate, adminHandler.GetImpersonatedRequests)
+			admin.POST("/impersonations/:id/end", impersonate, adminHandler.EndImpersonation)
+		}
 	}
 
 	// Serve uploaded files
 	router.GET("/uploads/:filename", uploadHandler.ServeUpload)
 
+	// Public keys for verifying our tokens
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+)
+
+// lastUsedResolution limits how often a token's last used time is written
+const lastUsedResolution = time.Minute
+
+var ErrInvalidAccessToken = errors.New("invalid or expired access token")
+
+// AuthenticateAccessToken looks up a personal access token and records that
+// it was used
+func AuthenticateAccessToken(rawToken string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := database.DB.Preload("User").Where("token_hash = ?", utils.HashToken(rawToken)).First(&token).Error; err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	// The owner may have been deleted
+	if token.IsExpired() || token.User.ID == 0 {
+		return nil, ErrInvalidAccessToken
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedResolution {
+		database.DB.Model(&token).Update("last_used_at", now)
+	}
+	return &token, nil
+}
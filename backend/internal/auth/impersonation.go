@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+)
+
+// ImpersonationAllows reports whether an impersonation token may make a
+// request with the given method. Read-only tokens may only read, and nobody
+// may delete anything while impersonating.
+func ImpersonationAllows(claims *utils.Claims, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodDelete:
+		return false
+	default:
+		return !claims.ReadOnly
+	}
+}
+
+// AuditImpersonatedRequest writes an audit record for a request made with
+// an impersonation token
+func AuditImpersonatedRequest(entry models.ImpersonatedRequest) error {
+	return database.DB.Create(&entry).Error
+}
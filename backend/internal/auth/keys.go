@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+)
+
+// Keys signs and verifies every token the API issues. It is set by LoadKeys.
+var Keys *utils.KeySet
+
+// LoadKeys builds the key set for the configured JWT algorithm
+func LoadKeys(cfg *config.Config) error {
+	switch cfg.JWTAlgorithm {
+	case utils.AlgHS256:
+		Keys = utils.NewHMACKeySet(cfg.JWTSecret)
+		return nil
+	case utils.AlgRS256, utils.AlgEdDSA:
+		if cfg.JWTPrivateKeyFile == "" {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", cfg.JWTAlgorithm)
+		}
+		keys, err := utils.LoadKeySet(cfg.JWTPrivateKeyFile, cfg.JWTVerifyKeyFiles)
+		if err != nil {
+			return err
+		}
+		if keys.Algorithm() != cfg.JWTAlgorithm {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE holds a %s key, but JWT_ALGORITHM is %s", keys.Algorithm(), cfg.JWTAlgorithm)
+		}
+		Keys = keys
+		return nil
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWTAlgorithm)
+	}
+}
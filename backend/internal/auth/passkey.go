@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// NewWebAuthn configures the relying party passkeys are registered with
+func NewWebAuthn(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	origins := cfg.WebAuthnOrigins
+	if len(origins) == 0 {
+		origins = []string{cfg.AppURL}
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.AppName,
+		RPOrigins:     origins,
+	})
+}
+
+// PasskeyUser adapts a user and their passkeys to webauthn.User
+type PasskeyUser struct {
+	User     *models.User
+	Passkeys []models.Passkey
+}
+
+func (u *PasskeyUser) WebAuthnID() []byte {
+	return u.User.WebAuthnHandle
+}
+
+func (u *PasskeyUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.User.FirstName + " " + u.User.LastName)
+}
+
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.Passkeys))
+	for i := range u.Passkeys {
+		credentials[i] = PasskeyCredential(&u.Passkeys[i])
+	}
+	return credentials
+}
+
+// PasskeyCredential converts a stored passkey back into the credential
+// record the WebAuthn library verifies assertions against
+func PasskeyCredential(p *models.Passkey) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	if p.Transports != "" {
+		for _, t := range strings.Split(p.Transports, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: p.BackupEligible,
+			BackupState:    p.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       p.AAGUID,
+			SignCount:    uint32(p.SignCount),
+			CloneWarning: p.CloneWarning,
+		},
+	}
+}
+
+// NewPasskey builds the passkey to store for a freshly registered credential
+func NewPasskey(userID uint, name string, credential *webauthn.Credential) models.Passkey {
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	return models.Passkey{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+}
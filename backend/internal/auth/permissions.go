@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"github.com/applifylab/social-feed-backend/internal/models"
+)
+
+// Permission is an action only some roles may perform
+type Permission string
+
+const (
+	PermModeratePosts     Permission = "moderate_posts"
+	PermModerateComments  Permission = "moderate_comments"
+	PermViewModerationLog Permission = "view_moderation_log"
+	PermViewLoginAuditLog Permission = "view_login_audit_log"
+	PermManageRoles       Permission = "manage_roles"
+	PermImpersonate       Permission = "impersonate"
+)
+
+// rolePermissions maps every role to the permissions it grants
+var rolePermissions = map[string][]Permission{
+	models.RoleUser: {},
+	models.RoleModerator: {
+		PermModeratePosts,
+		PermModerateComments,
+		PermViewModerationLog,
+	},
+	models.RoleAdmin: {
+		PermModeratePosts,
+		PermModerateComments,
+		PermViewModerationLog,
+		PermViewLoginAuditLog,
+		PermManageRoles,
+		PermImpersonate,
+	},
+}
+
+// HasPermission reports whether role grants perm
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by role
+func Permissions(role string) []Permission {
+	return rolePermissions[role]
+}
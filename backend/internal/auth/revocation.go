@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// tokenVersionTTL is how long a user's token version is cached before it is
+// read from the database again. Bumps made by this process are visible
+// immediately; other instances pick them up within this window.
+const tokenVersionTTL = time.Minute
+
+// sessionStateTTL is how long the revocation state of a session is cached.
+// Every database lookup also records the session as last seen.
+const sessionStateTTL = time.Minute
+
+type cachedVersion struct {
+	version   int
+	fetchedAt time.Time
+}
+
+type cachedSession struct {
+	revoked   bool
+	fetchedAt time.Time
+}
+
+var (
+	mu            sync.RWMutex
+	revokedTokens = map[string]time.Time{}
+	tokenVersions = map[uint]cachedVersion{}
+	sessionStates = map[uint]cachedSession{}
+)
+
+// LoadRevokedTokens fills the in-memory denylist from the database and drops
+// entries whose tokens have already expired
+func LoadRevokedTokens() error {
+	now := time.Now()
+	if err := database.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	var tokens []models.RevokedToken
+	if err := database.DB.Find(&tokens).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, token := range tokens {
+		revokedTokens[token.JTI] = token.ExpiresAt
+	}
+	return nil
+}
+
+// RevokeToken adds an access token to the denylist until it expires
+func RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	token := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	revokedTokens[jti] = expiresAt
+	mu.Unlock()
+	return nil
+}
+
+// IsTokenRevoked reports whether an access token is on the denylist
+func IsTokenRevoked(jti string) bool {
+	mu.RLock()
+	expiresAt, ok := revokedTokens[jti]
+	mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(expiresAt) {
+		// The token is expired anyway, no need to keep tracking it
+		mu.Lock()
+		delete(revokedTokens, jti)
+		mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// TokenVersion returns the current token version of a user
+func TokenVersion(userID uint) (int, error) {
+	mu.RLock()
+	cached, ok := tokenVersions[userID]
+	mu.RUnlock()
+	if ok && time.Since(cached.fetchedAt) < tokenVersionTTL {
+		return cached.version, nil
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "token_version").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+
+	mu.Lock()
+	tokenVersions[userID] = cachedVersion{version: user.TokenVersion, fetchedAt: time.Now()}
+	mu.Unlock()
+	return user.TokenVersion, nil
+}
+
+// BumpTokenVersion invalidates every access token issued to a user so far.
+// Call ForgetTokenVersion once the surrounding transaction has committed.
+func BumpTokenVersion(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+// ForgetTokenVersion drops the cached token version of a user so the next
+// lookup reads it from the database
+func ForgetTokenVersion(userID uint) {
+	mu.Lock()
+	delete(tokenVersions, userID)
+	mu.Unlock()
+}
+
+// IsSessionRevoked reports whether the session an access token belongs to
+// has been revoked. Unknown sessions count as revoked.
+func IsSessionRevoked(sessionID uint) (bool, error) {
+	mu.RLock()
+	cached, ok := sessionStates[sessionID]
+	mu.RUnlock()
+	if ok && time.Since(cached.fetchedAt) < sessionStateTTL {
+		return cached.revoked, nil
+	}
+
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		UpdateColumn("last_seen_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	revoked := result.RowsAffected == 0
+	mu.Lock()
+	sessionStates[sessionID] = cachedSession{revoked: revoked, fetchedAt: time.Now()}
+	mu.Unlock()
+	return revoked, nil
+}
+
+// MarkSessionRevoked makes this process reject the session's access tokens
+// right away. Other instances notice within sessionStateTTL.
+func MarkSessionRevoked(sessionID uint) {
+	mu.Lock()
+	sessionStates[sessionID] = cachedSession{revoked: true, fetchedAt: time.Now()}
+	mu.Unlock()
+}
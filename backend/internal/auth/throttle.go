@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+)
+
+// LockoutError is returned while an account or IP address is locked out
+type LockoutError struct {
+	// Account is true when the account is locked, false when the IP is throttled
+	Account    bool
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	if e.Account {
+		return fmt.Sprintf("account locked for %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many attempts, retry in %s", e.RetryAfter)
+}
+
+// CheckLoginAllowed returns a LockoutError if the IP address or the account
+// may not attempt to log in right now. With an empty email only the IP
+// address is checked.
+func CheckLoginAllowed(email, ip string) error {
+	keys := []string{ipKey(ip)}
+	if email != "" {
+		keys = append(keys, accountKey(email))
+	}
+
+	var throttles []models.LoginThrottle
+	if err := database.DB.Where("key IN ? AND locked_until > ?", keys, time.Now()).
+		Find(&throttles).Error; err != nil {
+		return err
+	}
+
+	var lockout *LockoutError
+	for _, t := range throttles {
+		retryAfter := time.Until(*t.LockedUntil)
+		isAccount := strings.HasPrefix(t.Key, "account:")
+		// The IP throttle wins, since it applies to every account
+		if lockout == nil || !isAccount {
+			lockout = &LockoutError{Account: isAccount, RetryAfter: retryAfter}
+		}
+	}
+	if lockout != nil {
+		return lockout
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed attempt against the account and the IP
+// address, locks them out with exponential backoff once they pass their
+// thresholds, and writes an audit record. Attempts without an email only
+// count against the IP address.
+func RecordLoginFailure(cfg *config.Config, attempt models.FailedLogin) error {
+	if err := AuditFailedLogin(attempt); err != nil {
+		return err
+	}
+
+	if attempt.Email != "" {
+		if err := recordFailure(cfg, accountKey(attempt.Email), cfg.LoginMaxFailures); err != nil {
+			return err
+		}
+	}
+	return recordFailure(cfg, ipKey(attempt.IPAddress), cfg.LoginIPMaxFailures)
+}
+
+// AuditFailedLogin writes an audit record without counting the attempt,
+// e.g. for attempts rejected because of an existing lockout
+func AuditFailedLogin(attempt models.FailedLogin) error {
+	attempt.Email = strings.ToLower(attempt.Email)
+	return database.DB.Create(&attempt).Error
+}
+
+// RecordLoginSuccess clears the failure count of an account
+func RecordLoginSuccess(email string) error {
+	return database.DB.Where("key = ?", accountKey(email)).Delete(&models.LoginThrottle{}).Error
+}
+
+// recordFailure increments the failure counter for key, starting over when
+// the previous failure is outside the window
+func recordFailure(cfg *config.Config, key string, maxFailures int) error {
+	now := time.Now()
+	var failures int
+	err := database.DB.Raw(`
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures
+	`, key, now, now.Add(-cfg.LoginFailureWindow)).Scan(&failures).Error
+	if err != nil {
+		return err
+	}
+
+	if failures < maxFailures {
+		return nil
+	}
+
+	return database.DB.Model(&models.LoginThrottle{}).
+		Where("key = ?", key).
+		Update("locked_until", now.Add(lockoutDuration(cfg, failures-maxFailures))).Error
+}
+
+// lockoutDuration doubles the base lockout for every failure past the
+// threshold, up to the configured maximum
+func lockoutDuration(cfg *config.Config, excess int) time.Duration {
+	d := float64(cfg.LoginLockoutBase) * math.Pow(2, float64(excess))
+	if d > float64(cfg.LoginLockoutMax) {
+		return cfg.LoginLockoutMax
+	}
+	return time.Duration(d)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
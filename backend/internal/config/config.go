@@ -1,24 +1,116 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Unverified user policies
+const (
+	PolicyAllow    = "allow"
+	PolicyReadOnly = "read_only"
+	PolicyBlock    = "block"
+)
+
+// defaultJWTSecret is only acceptable for local development
+const defaultJWTSecret = "change-this-secret-key"
+
 type Config struct {
-	Port          string
-	DBHost        string
-	DBPort        string
-	DBUser        string
-	DBPassword    string
-	DBName        string
-	DBSSLMode     string
-	JWTSecret     string
-	UploadDir     string
-	MaxUploadSize int64
-	AllowedOrigins string
+	GinMode         string
+	Port            string
+	DBHost          string
+	DBPort          string
+	DBUser          string
+	DBPassword      string
+	DBName          string
+	DBSSLMode       string
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	MFATokenTTL     time.Duration
+	ImpersonateTTL  time.Duration
+	UploadDir       string
+	MaxUploadSize   int64
+	AllowedOrigins  string
+
+	// Token signing: HS256 uses JWTSecret, RS256/EdDSA use PEM key files.
+	// Verify keys stay valid during a rotation.
+	JWTAlgorithm      string
+	JWTPrivateKeyFile string
+	JWTVerifyKeyFiles []string
+
+	// Login throttling: accounts and IPs are locked out after too many
+	// failures within the window, for a duration that doubles every time
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginFailureWindow time.Duration
+	LoginLockoutBase   time.Duration
+	LoginLockoutMax    time.Duration
+
+	// Proxies allowed to set X-Forwarded-For; empty trusts none
+	TrustedProxies []string
+
+	// Shown in emails and authenticator apps; links in emails point at the frontend
+	AppName              string
+	AppURL               string
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	EmailChangeTTL       time.Duration
+	MagicLinkTTL         time.Duration
+
+	// Deleted accounts can be restored for AccountDeletionGrace, after which
+	// a job running every AccountPurgeInterval removes or anonymizes their data
+	AccountDeletionGrace time.Duration
+	AccountPurgeInterval time.Duration
+
+	// Data export archives are written to ExportDir and can be downloaded
+	// for ExportTTL
+	ExportDir string
+	ExportTTL time.Duration
+
+	// New posts are written to the home timeline of each follower unless the
+	// author has more than FanoutMaxFollowers, then they're read on demand
+	FanoutMaxFollowers int
+
+	// What unverified users may do with users, the feed, posts, comments
+	// and uploads: "allow" everything, "read_only" (no posting, commenting,
+	// liking or uploading) or "block" them. Account, moderation and admin
+	// endpoints aren't restricted.
+	UnverifiedUserPolicy string
+
+	// Public URL of this API, used for OAuth callback URLs
+	PublicURL string
+
+	// Passkeys: the relying party ID is the domain passkeys are bound to,
+	// origins default to AppURL
+	WebAuthnRPID    string
+	WebAuthnOrigins []string
+
+	// Social login providers, each enabled by setting its client ID
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+	GitHubAPIURL       string
+	OIDCName           string
+	OIDCIssuer         string
+	OIDCClientID       string
+	OIDCClientSecret   string
+
+	// Mail delivery: "log" writes emails to MailDir, "smtp" sends them
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
 }
 
 func Load() *Config {
@@ -28,23 +120,133 @@ func Load() *Config {
 	}
 
 	return &Config{
-		Port:           getEnv("PORT", "8080"),
-		DBHost:         getEnv("DB_HOST", "localhost"),
-		DBPort:         getEnv("DB_PORT", "5432"),
-		DBUser:         getEnv("DB_USER", "postgres"),
-		DBPassword:     getEnv("DB_PASSWORD", ""),
-		DBName:         getEnv("DB_NAME", "social_feed"),
-		DBSSLMode:      getEnv("DB_SSLMODE", "disable"),
-		JWTSecret:      getEnv("JWT_SECRET", "change-this-secret-key"),
-		UploadDir:      getEnv("UPLOAD_DIR", "./uploads"),
-		MaxUploadSize:  5242880, // 5MB
-		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "http://localhost:3000"),
+		GinMode:         getEnv("GIN_MODE", "debug"),
+		Port:            getEnv("PORT", "8080"),
+		DBHost:          getEnv("DB_HOST", "localhost"),
+		DBPort:          getEnv("DB_PORT", "5432"),
+		DBUser:          getEnv("DB_USER", "postgres"),
+		DBPassword:      getEnv("DB_PASSWORD", ""),
+		DBName:          getEnv("DB_NAME", "social_feed"),
+		DBSSLMode:       getEnv("DB_SSLMODE", "disable"),
+		JWTSecret:       getEnv("JWT_SECRET", defaultJWTSecret),
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		MFATokenTTL:     getEnvDuration("MFA_TOKEN_TTL", 5*time.Minute),
+		ImpersonateTTL:  getEnvDuration("IMPERSONATE_TTL", 30*time.Minute),
+		UploadDir:       getEnv("UPLOAD_DIR", "./uploads"),
+		MaxUploadSize:   5242880, // 5MB
+		AllowedOrigins:  getEnv("ALLOWED_ORIGINS", "http://localhost:3000"),
+
+		JWTAlgorithm:      getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTVerifyKeyFiles: getEnvList("JWT_VERIFY_KEY_FILES"),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures: getEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+		LoginFailureWindow: getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutBase:   getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:    getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+
+		AppName:              getEnv("APP_NAME", "Social Feed"),
+		AppURL:               getEnv("APP_URL", "http://localhost:3000"),
+		PasswordResetTTL:     getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL: getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		EmailChangeTTL:       getEnvDuration("EMAIL_CHANGE_TTL", 24*time.Hour),
+		MagicLinkTTL:         getEnvDuration("MAGIC_LINK_TTL", 15*time.Minute),
+		UnverifiedUserPolicy: getEnv("UNVERIFIED_USER_POLICY", PolicyReadOnly),
+
+		AccountDeletionGrace: getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AccountPurgeInterval: getEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+
+		ExportDir: getEnv("EXPORT_DIR", "./exports"),
+		ExportTTL: getEnvDuration("EXPORT_TTL", 48*time.Hour),
+
+		FanoutMaxFollowers: getEnvInt("FANOUT_MAX_FOLLOWERS", 10000),
+
+		PublicURL: getEnv("PUBLIC_URL", "http://localhost:8080"),
+
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnOrigins: getEnvList("WEBAUTHN_ORIGINS"),
+
+		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+		GitHubAPIURL:       getEnv("GITHUB_API_URL", "https://api.github.com"),
+		OIDCName:           getEnv("OIDC_NAME", "oidc"),
+		OIDCIssuer:         getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailDir:      getEnv("MAIL_DIR", ""),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "1025"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 	}
 }
 
+// IsDevelopment reports whether the server runs outside gin's release mode
+func (c *Config) IsDevelopment() bool {
+	return c.GinMode != "release"
+}
+
+// Validate refuses configurations that are unsafe in production
+func (c *Config) Validate() error {
+	if !c.IsDevelopment() && c.JWTAlgorithm == "HS256" && c.JWTSecret == defaultJWTSecret {
+		return errors.New("JWT_SECRET must be changed from its default value when GIN_MODE=release")
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvInt parses an integer from the environment
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvDuration parses a duration such as "15m" or "720h" from the environment
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvList splits a comma separated environment variable
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
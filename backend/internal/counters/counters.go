@@ -0,0 +1,119 @@
+// Package counters keeps the like, comment and reply counts stored on posts
+// and comments in step with the rows they count. Writes adjust them in the
+// same transaction as the like or comment they add or remove, so lists can
+// read them without counting. Reconcile repairs counters that drifted anyway.
+package counters
+
+import (
+	"fmt"
+
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// AddLikes adds delta to the likes count of a post or comment
+func AddLikes(tx *gorm.DB, likeableType string, likeableID uint, delta int64) error {
+	var model interface{} = &models.Post{}
+	if likeableType == "comment" {
+		model = &models.Comment{}
+	}
+	return add(tx, model, likeableID, "likes_count", delta)
+}
+
+// AddComments adds delta to the comments count of the post a comment is on,
+// or to the replies count of its parent if it is a reply
+func AddComments(tx *gorm.DB, comment *models.Comment, delta int64) error {
+	if comment.ParentCommentID != nil {
+		return add(tx, &models.Comment{}, *comment.ParentCommentID, "replies_count", delta)
+	}
+	return add(tx, &models.Post{}, comment.PostID, "comments_count", delta)
+}
+
+// Counters of deleted posts and comments are kept too, so Reconcile finds
+// nothing to fix on them
+func add(tx *gorm.DB, model interface{}, id uint, column string, delta int64) error {
+	return tx.Unscoped().Model(model).
+		Where("id = ?", id).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+// The counts a post's and a comment's counters should hold. Comments count
+// the top-level comments on a post and replies the direct replies to a
+// comment; hidden ones are included, deleted ones are not.
+const (
+	recountPosts = `
+		UPDATE posts SET likes_count = actual.likes, comments_count = actual.comments
+		FROM (
+			SELECT p.id,
+				(SELECT COUNT(*) FROM likes WHERE likes.likeable_type = 'post' AND likes.likeable_id = p.id) AS likes,
+				(SELECT COUNT(*) FROM comments WHERE comments.post_id = p.id AND comments.parent_comment_id IS NULL AND comments.deleted_at IS NULL) AS comments
+			FROM posts p WHERE %s
+		) AS actual
+		WHERE posts.id = actual.id AND (posts.likes_count <> actual.likes OR posts.comments_count <> actual.comments)`
+
+	recountComments = `
+		UPDATE comments SET likes_count = actual.likes, replies_count = actual.replies
+		FROM (
+			SELECT c.id,
+				(SELECT COUNT(*) FROM likes WHERE likes.likeable_type = 'comment' AND likes.likeable_id = c.id) AS likes,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = c.id AND r.deleted_at IS NULL) AS replies
+			FROM comments c WHERE %s
+		) AS actual
+		WHERE comments.id = actual.id AND (comments.likes_count <> actual.likes OR comments.replies_count <> actual.replies)`
+)
+
+// Recount sets the counters of the given posts and comments from the rows
+// they count. It is for bulk changes that don't go through AddLikes and
+// AddComments, such as purging an account.
+func Recount(tx *gorm.DB, postIDs, commentIDs []uint) error {
+	if err := recountIDs(tx, recountPosts, "p.id", postIDs); err != nil {
+		return err
+	}
+	return recountIDs(tx, recountComments, "c.id", commentIDs)
+}
+
+// recountChunk keeps the ID lists within the bind parameter limit
+const recountChunk = 1000
+
+func recountIDs(tx *gorm.DB, recount, idColumn string, ids []uint) error {
+	query := fmt.Sprintf(recount, idColumn+" IN ?")
+	for len(ids) > 0 {
+		chunk := ids[:min(len(ids), recountChunk)]
+		if err := tx.Exec(query, chunk).Error; err != nil {
+			return err
+		}
+		ids = ids[len(chunk):]
+	}
+	return nil
+}
+
+// Reconcile recounts every post and comment, batchSize rows at a time, and
+// returns how many of them had a counter that was wrong. Each batch is its
+// own statement, so it can run while the API is serving; a counter that
+// changes while its batch is recounted may be left off by one until the
+// next run.
+func Reconcile(db *gorm.DB, batchSize int) (posts, comments int64, err error) {
+	if posts, err = reconcileTable(db, "posts", recountPosts, "p.id", batchSize); err != nil {
+		return posts, 0, err
+	}
+	comments, err = reconcileTable(db, "comments", recountComments, "c.id", batchSize)
+	return posts, comments, err
+}
+
+func reconcileTable(db *gorm.DB, table, recount, idColumn string, batchSize int) (int64, error) {
+	var maxID uint
+	if err := db.Table(table).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(recount, idColumn+" > ? AND "+idColumn+" <= ?")
+	var fixed int64
+	for from := uint(0); from < maxID; from += uint(batchSize) {
+		result := db.Exec(query, from, from+uint(batchSize))
+		if result.Error != nil {
+			return fixed, fmt.Errorf("failed to recount %s after id %d: %w", table, from, result.Error)
+		}
+		fixed += result.RowsAffected
+	}
+	return fixed, nil
+}
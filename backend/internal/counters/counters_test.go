@@ -0,0 +1,162 @@
+package counters_test
+
+import (
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/counters"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// fixture is a few posts and comments whose counters start out right
+type fixture struct {
+	posts    []models.Post
+	comments []models.Comment
+}
+
+// The counts the fixture's counters should hold
+var (
+	wantPosts    = [][2]int64{{2, 2}, {1, 0}, {0, 1}} // likes, comments
+	wantComments = [][2]int64{{1, 2}, {0, 0}, {0, 0}} // likes, replies
+)
+
+func newFixture(t *testing.T, db *gorm.DB) *fixture {
+	t.Helper()
+
+	user := models.User{FirstName: "Test", LastName: "User", Handle: "user", Email: "user@example.com"}
+	mustCreate(t, db, &user)
+	other := models.User{FirstName: "Test", LastName: "Other", Handle: "other", Email: "other@example.com"}
+	mustCreate(t, db, &other)
+
+	f := &fixture{}
+	for range wantPosts {
+		post := models.Post{UserID: user.ID, Content: "Post", Visibility: models.VisibilityPublic}
+		mustCreate(t, db, &post)
+		f.posts = append(f.posts, post)
+	}
+
+	// Two comments on the first post, one on the third, and a deleted one
+	// that doesn't count
+	for _, postID := range []uint{f.posts[0].ID, f.posts[0].ID, f.posts[2].ID} {
+		comment := models.Comment{PostID: postID, UserID: user.ID, Content: "Comment"}
+		mustCreate(t, db, &comment)
+		f.comments = append(f.comments, comment)
+	}
+	deleted := models.Comment{PostID: f.posts[1].ID, UserID: user.ID, Content: "Deleted"}
+	mustCreate(t, db, &deleted)
+	mustDelete(t, db, &deleted)
+
+	// Two replies to the first comment and a deleted one
+	parentID := f.comments[0].ID
+	for i := 0; i < 3; i++ {
+		reply := models.Comment{PostID: f.posts[0].ID, UserID: user.ID, ParentCommentID: &parentID, Content: "Reply"}
+		mustCreate(t, db, &reply)
+		if i == 2 {
+			mustDelete(t, db, &reply)
+		}
+	}
+
+	for _, like := range []models.Like{
+		{UserID: user.ID, LikeableType: "post", LikeableID: f.posts[0].ID},
+		{UserID: other.ID, LikeableType: "post", LikeableID: f.posts[0].ID},
+		{UserID: user.ID, LikeableType: "post", LikeableID: f.posts[1].ID},
+		{UserID: user.ID, LikeableType: "comment", LikeableID: f.comments[0].ID},
+	} {
+		mustCreate(t, db, &like)
+	}
+
+	for i, post := range f.posts {
+		db.Model(&post).UpdateColumns(map[string]interface{}{"likes_count": wantPosts[i][0], "comments_count": wantPosts[i][1]})
+	}
+	for i, comment := range f.comments {
+		db.Model(&comment).UpdateColumns(map[string]interface{}{"likes_count": wantComments[i][0], "replies_count": wantComments[i][1]})
+	}
+	return f
+}
+
+// check fails the test unless the fixture's counters hold the right counts
+func (f *fixture) check(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	for i, post := range f.posts {
+		db.First(&post, post.ID)
+		if got := [2]int64{post.LikesCount, post.CommentsCount}; got != wantPosts[i] {
+			t.Errorf("post %d likes, comments = %v, want %v", i, got, wantPosts[i])
+		}
+	}
+	for i, comment := range f.comments {
+		db.First(&comment, comment.ID)
+		if got := [2]int64{comment.LikesCount, comment.RepliesCount}; got != wantComments[i] {
+			t.Errorf("comment %d likes, replies = %v, want %v", i, got, wantComments[i])
+		}
+	}
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, v interface{}) {
+	t.Helper()
+	if err := db.Create(v).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustDelete(t *testing.T, db *gorm.DB, v interface{}) {
+	t.Helper()
+	if err := db.Delete(v).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	db := testdb.Open(t)
+	f := newFixture(t, db)
+
+	fixedPosts, fixedComments, err := counters.Reconcile(database.DB, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixedPosts != 0 || fixedComments != 0 {
+		t.Fatalf("Reconcile fixed %d posts and %d comments of a correct fixture", fixedPosts, fixedComments)
+	}
+
+	// Two posts and two comments drift, one of them on both counters
+	db.Model(&f.posts[0]).UpdateColumn("likes_count", 7)
+	db.Model(&f.posts[2]).UpdateColumns(map[string]interface{}{"likes_count": 3, "comments_count": 0})
+	db.Model(&f.comments[0]).UpdateColumn("replies_count", 5)
+	db.Model(&f.comments[2]).UpdateColumn("likes_count", -1)
+
+	// A batch size smaller than the tables recounts them in several batches
+	fixedPosts, fixedComments, err = counters.Reconcile(database.DB, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixedPosts != 2 || fixedComments != 2 {
+		t.Errorf("Reconcile fixed %d posts and %d comments, want 2 and 2", fixedPosts, fixedComments)
+	}
+	f.check(t, db)
+}
+
+func TestRecount(t *testing.T) {
+	db := testdb.Open(t)
+	f := newFixture(t, db)
+
+	db.Model(&f.posts[0]).UpdateColumn("comments_count", 0)
+	db.Model(&f.posts[1]).UpdateColumn("likes_count", 9)
+	db.Model(&f.comments[0]).UpdateColumn("likes_count", 4)
+
+	// Only the posts and comments asked for are recounted
+	if err := counters.Recount(db, []uint{f.posts[0].ID}, []uint{f.comments[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	var stale models.Post
+	db.First(&stale, f.posts[1].ID)
+	if stale.LikesCount != 9 {
+		t.Errorf("post outside the recount has likes_count %d, want it left at 9", stale.LikesCount)
+	}
+
+	if err := counters.Recount(db, []uint{f.posts[1].ID}, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.check(t, db)
+}
@@ -1,11 +1,14 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
 	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/counters"
 	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -35,17 +38,84 @@ func Connect(cfg *config.Config) error {
 // AutoMigrate runs database migrations
 func AutoMigrate() error {
 	log.Println("Running database migrations...")
-	
+
+	// Accounts created before email verification existed are trusted as verified
+	grandfatherVerified := DB.Migrator().HasTable(&models.User{}) &&
+		!DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	// The is_private flag was replaced by visibility
+	migratePrivateFlag := DB.Migrator().HasColumn(&models.Post{}, "is_private")
+
+	// Like, comment and reply counts used to be counted on every read
+	backfillCounters := DB.Migrator().HasTable(&models.Post{}) &&
+		!DB.Migrator().HasColumn(&models.Post{}, "LikesCount")
+
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.Post{},
 		&models.Comment{},
 		&models.Like{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.FailedLogin{},
+		&models.LoginThrottle{},
+		&models.PersonalAccessToken{},
+		&models.ModerationAction{},
+		&models.Passkey{},
+		&models.PasskeyChallenge{},
+		&models.Impersonation{},
+		&models.ImpersonatedRequest{},
+		&models.DataExport{},
+		&models.Follow{},
+		&models.TimelineEntry{},
+		&models.Block{},
+		&models.Mute{},
+		&models.PostAudience{},
+		&models.CloseFriend{},
+		&models.Upload{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// The home timeline index was replaced by one that also covers the post
+	// ID pages end on
+	if DB.Migrator().HasIndex(&models.TimelineEntry{}, "idx_timeline_user_created") {
+		if err := DB.Migrator().DropIndex(&models.TimelineEntry{}, "idx_timeline_user_created"); err != nil {
+			return fmt.Errorf("failed to drop idx_timeline_user_created: %w", err)
+		}
+	}
+
+	if grandfatherVerified {
+		if err := DB.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			return fmt.Errorf("failed to mark existing users as verified: %w", err)
+		}
+	}
+
+	if migratePrivateFlag {
+		if err := DB.Exec("UPDATE posts SET visibility = ? WHERE is_private", models.VisibilityOnlyMe).Error; err != nil {
+			return fmt.Errorf("failed to migrate private posts: %w", err)
+		}
+		if err := DB.Migrator().DropColumn(&models.Post{}, "is_private"); err != nil {
+			return fmt.Errorf("failed to drop is_private column: %w", err)
+		}
+	}
+
+	if backfillCounters {
+		if _, _, err := counters.Reconcile(DB, 10000); err != nil {
+			return fmt.Errorf("failed to backfill counters: %w", err)
+		}
+	}
+
+	// Accounts created before handles existed get a placeholder one
+	if err := DB.Exec("UPDATE users SET handle = 'user' || id WHERE handle IS NULL OR handle = ''").Error; err != nil {
+		return fmt.Errorf("failed to assign handles: %w", err)
+	}
+
 	// Create unique index for likes
 	DB.Exec(`
 		CREATE UNIQUE INDEX IF NOT EXISTS idx_unique_like 
@@ -56,6 +126,14 @@ func AutoMigrate() error {
 	return nil
 }
 
+// IsUniqueViolation reports whether err was caused by a unique constraint.
+// gorm.ErrDuplicatedKey is what connections opened with TranslateError
+// return, such as the SQLite databases tests run against.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" || errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"`
+}
+
+type CreateAccessTokenResponse struct {
+	Token       string                             `json:"token"`
+	AccessToken models.PersonalAccessTokenResponse `json:"access_token"`
+}
+
+// CreateAccessToken creates a personal access token for the current user.
+// The token is only shown in this response.
+func (h *AuthHandler) CreateAccessToken(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	scopes := map[string]bool{}
+	for _, scope := range req.Scopes {
+		if !models.IsValidTokenScope(scope) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "validation_error",
+				fmt.Sprintf("Unknown scope %q, valid scopes are: %s", scope, strings.Join(models.TokenScopes, ", ")))
+			return
+		}
+		scopes[scope] = true
+	}
+	scopeList := make([]string, 0, len(scopes))
+	for scope := range scopes {
+		scopeList = append(scopeList, scope)
+	}
+	sort.Strings(scopeList)
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+	rawToken := models.AccessTokenPrefix + secret
+
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: utils.HashToken(rawToken),
+		Hint:      rawToken[:len(models.AccessTokenPrefix)+4],
+		Scopes:    strings.Join(scopeList, " "),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&token).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create token")
+		return
+	}
+
+	utils.SuccessResponse(c, CreateAccessTokenResponse{
+		Token:       rawToken,
+		AccessToken: token.ToResponse(),
+	}, "Token created. Copy it now, it won't be shown again")
+}
+
+// GetAccessTokens lists the current user's personal access tokens
+func (h *AuthHandler) GetAccessTokens(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var tokens []models.PersonalAccessToken
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch tokens")
+		return
+	}
+
+	responses := make([]models.PersonalAccessTokenResponse, len(tokens))
+	for i, token := range tokens {
+		responses[i] = token.ToResponse()
+	}
+
+	utils.SuccessResponse(c, responses, fmt.Sprintf("%d tokens found", len(responses)))
+}
+
+// DeleteAccessToken revokes one of the current user's personal access tokens
+func (h *AuthHandler) DeleteAccessToken(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to delete token")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Token not found")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Token deleted successfully")
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type RestoreAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// DeleteAccount deletes the current user's account. The account disappears
+// immediately and can be restored with the emailed link until the grace
+// period ends, when the purge job removes or anonymizes its data.
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	// The body is optional for accounts without a password
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	// Accounts that only use social login or passkeys have no password
+	if user.PasswordHash != "" && !utils.CheckPassword(user.PasswordHash, req.Password) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Password is incorrect")
+		return
+	}
+
+	var token string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Links already emailed, such as a password reset or magic link,
+		// must not work on the deleted account
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		token, err = createUserToken(tx, user.ID, models.TokenPurposeAccountRestore, h.cfg.AccountDeletionGrace)
+		if err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		if err := auth.BumpTokenVersion(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to delete account")
+		return
+	}
+	auth.ForgetTokenVersion(user.ID)
+
+	purgeAfter := time.Now().Add(h.cfg.AccountDeletionGrace)
+	link := fmt.Sprintf("%s/restore-account?token=%s", h.cfg.AppURL, url.QueryEscape(token))
+	h.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour %s account has been deleted. Your posts, comments and likes will be removed for good on %s.\n\nIf you change your mind before then, open the link below to restore your account.\n\n%s\n",
+			user.FirstName, h.cfg.AppName, purgeAfter.Format("January 2, 2006"), link),
+	})
+
+	utils.SuccessResponse(c, gin.H{"purge_after": purgeAfter}, "Account deleted")
+}
+
+// RestoreAccount cancels a pending account deletion using the link emailed
+// when the account was deleted. The user logs in again afterwards.
+func (h *AuthHandler) RestoreAccount(c *gin.Context) {
+	var req RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposeAccountRestore)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&models.User{}).
+			Where("id = ? AND deleted_at IS NOT NULL AND anonymized_at IS NULL", token.UserID).
+			Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidUserToken
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_token", "Invalid or expired restore link")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to restore account")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Account restored. You can log in again")
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/oauth"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+)
+
+func createToken(t *testing.T, user *models.User, purpose string) string {
+	t.Helper()
+
+	token, err := createUserToken(database.DB, user.ID, purpose, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestDeleteAccountInvalidatesEmailedTokens(t *testing.T) {
+	testdb.Open(t)
+	h := newAuthHandler(t)
+	user := createUser(t, "alice")
+
+	magicLink := createToken(t, user, models.TokenPurposeMagicLink)
+	createToken(t, user, models.TokenPurposePasswordReset)
+	createToken(t, user, models.TokenPurposeEmailChange)
+
+	if w := serve(t, h.DeleteAccount, http.MethodDelete, "/", nil, user.ID); w.Code != http.StatusOK {
+		t.Fatalf("DeleteAccount status = %d: %s", w.Code, w.Body)
+	}
+
+	var purposes []string
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Pluck("purpose", &purposes)
+	if len(purposes) != 1 || purposes[0] != models.TokenPurposeAccountRestore {
+		t.Errorf("outstanding tokens = %v, want only the restore token", purposes)
+	}
+
+	w := serve(t, h.RedeemMagicLink, http.MethodPost, "/", RedeemMagicLinkRequest{Token: magicLink}, 0)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("RedeemMagicLink status = %d, want 401", w.Code)
+	}
+}
+
+// Tokens issued before deletion invalidated them, or racing with it, must
+// still not act on the deleted account
+func TestUserTokenOfDeletedAccount(t *testing.T) {
+	testdb.Open(t)
+	h := newAuthHandler(t)
+	user := createUser(t, "alice")
+
+	magicLink := createToken(t, user, models.TokenPurposeMagicLink)
+	reset := createToken(t, user, models.TokenPurposePasswordReset)
+	verification := createToken(t, user, models.TokenPurposeEmailVerification)
+	restore := createToken(t, user, models.TokenPurposeAccountRestore)
+	if err := database.DB.Delete(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"RedeemMagicLink": serve(t, h.RedeemMagicLink, http.MethodPost, "/", RedeemMagicLinkRequest{Token: magicLink}, 0),
+		"ResetPassword":   serve(t, h.ResetPassword, http.MethodPost, "/", ResetPasswordRequest{Token: reset, Password: "new-password"}, 0),
+		"VerifyEmail":     serve(t, h.VerifyEmail, http.MethodPost, "/", VerifyEmailRequest{Token: verification}, 0),
+	} {
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != "account_deleted" {
+			t.Errorf("%s = %d %s, want 401 account_deleted", name, w.Code, w.Body)
+		}
+	}
+
+	w := serve(t, h.RestoreAccount, http.MethodPost, "/", RestoreAccountRequest{Token: restore}, 0)
+	if w.Code != http.StatusOK {
+		t.Fatalf("RestoreAccount status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestOAuthLoginToDeletedAccount(t *testing.T) {
+	testdb.Open(t)
+	linked := createUser(t, "alice")
+	unlinked := createUser(t, "bob")
+
+	database.DB.Create(&models.UserIdentity{UserID: linked.ID, Provider: "github", Subject: "1", Email: linked.Email})
+	database.DB.Delete(linked)
+	database.DB.Delete(unlinked)
+
+	for _, identity := range []*oauth.Identity{
+		{Subject: "1", Email: linked.Email, EmailVerified: true},
+		{Subject: "2", Email: unlinked.Email, EmailVerified: true},
+	} {
+		if _, err := findOrCreateOAuthUser("github", identity); !errors.Is(err, errAccountDeleted) {
+			t.Errorf("identity %s: err = %v, want errAccountDeleted", identity.Subject, err)
+		}
+	}
+}
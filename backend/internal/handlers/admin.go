@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	cfg *config.Config
+}
+
+func NewAdminHandler(cfg *config.Config) *AdminHandler {
+	return &AdminHandler{cfg: cfg}
+}
+
+// GetFailedLogins lists failed login attempts, newest first. Filter with
+// the email, ip and user_id query parameters.
+func (h *AdminHandler) GetFailedLogins(c *gin.Context) {
+	page, ok := utils.ParsePage(c, 50)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Model(&models.FailedLogin{})
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", strings.ToLower(email))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var attempts []models.FailedLogin
+	if err := page.Apply(query, "failed_logins", false).Find(&attempts).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch login attempts")
+		return
+	}
+	attempts, next := utils.NextPage(attempts, page, func(a *models.FailedLogin) (time.Time, uint) {
+		return a.CreatedAt, a.ID
+	})
+
+	utils.PaginatedSuccessResponse(c, attempts, page.Limit, next)
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateUserRole changes a user's role. Their existing access tokens are
+// invalidated so the new role takes effect immediately.
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	adminID, _ := middleware.GetUserID(c)
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_role", "Unknown role: "+req.Role)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+
+	if user.ID == adminID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_request", "You can't change your own role")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", req.Role).Error; err != nil {
+			return err
+		}
+		return auth.BumpTokenVersion(tx, user.ID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update role")
+		return
+	}
+	auth.ForgetTokenVersion(user.ID)
+
+	utils.SuccessResponse(c, user.ToAccountResponse(), "Role updated successfully")
+}
@@ -1,23 +1,31 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/applifylab/social-feed-backend/internal/auth"
 	"github.com/applifylab/social-feed-backend/internal/config"
 	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
 	"github.com/applifylab/social-feed-backend/internal/middleware"
 	"github.com/applifylab/social-feed-backend/internal/models"
 	"github.com/applifylab/social-feed-backend/internal/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	cfg *config.Config
+	cfg    *config.Config
+	mailer mailer.Mailer
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{cfg: cfg}
+func NewAuthHandler(cfg *config.Config, m mailer.Mailer) *AuthHandler {
+	return &AuthHandler{cfg: cfg, mailer: m}
 }
 
 type RegisterRequest struct {
@@ -25,6 +33,7 @@ type RegisterRequest struct {
 	LastName  string `json:"last_name" binding:"required"`
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,min=6"`
+	Handle    string `json:"handle"` // picked from the email address when empty
 }
 
 type LoginRequest struct {
@@ -32,9 +41,15 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type AuthResponse struct {
-	Token string              `json:"token"`
-	User  models.UserResponse `json:"user"`
+	Token        string                 `json:"token"`
+	RefreshToken string                 `json:"refresh_token"`
+	ExpiresIn    int64                  `json:"expires_in"`
+	User         models.AccountResponse `json:"user"`
 }
 
 // Register handles user registration
@@ -59,30 +74,75 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	handle := strings.ToLower(strings.TrimPrefix(req.Handle, "@"))
+	if handle != "" && !models.IsValidHandle(handle) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "validation_error",
+			"Handle must be 3 to 30 letters, digits or underscores")
+		return
+	}
+
 	// Create user
 	user := models.User{
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
 		Email:        strings.ToLower(req.Email),
 		PasswordHash: hashedPassword,
+		Role:         models.RoleUser,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if handle == "" {
+			localPart, _, _ := strings.Cut(user.Email, "@")
+			generated, err := newHandle(tx, localPart)
+			if err != nil {
+				return err
+			}
+			user.Handle = generated
+		} else {
+			var count int64
+			tx.Unscoped().Model(&models.User{}).Where("handle = ?", handle).Count(&count)
+			if count > 0 {
+				return errHandleTaken
+			}
+			user.Handle = handle
+		}
+		return tx.Create(&user).Error
+	})
+	// Someone may have registered the handle or email since they were
+	// checked, or the email belongs to a deleted account
+	if database.IsUniqueViolation(err) && emailTaken(user.Email) {
+		utils.ErrorResponse(c, http.StatusConflict, "user_exists", "User with this email already exists")
+		return
+	}
+	if errors.Is(err, errHandleTaken) || database.IsUniqueViolation(err) {
+		utils.ErrorResponse(c, http.StatusConflict, "handle_taken", "This handle is already taken")
+		return
+	}
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create user")
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Email, h.cfg.JWTSecret)
+	// Ask the user to confirm their email address
+	if err := h.sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Start a session and issue tokens
+	resp, err := issueSession(c, h.cfg, &user)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
 		return
 	}
 
-	utils.SuccessResponse(c, AuthResponse{
-		Token: token,
-		User:  user.ToResponse(),
-	}, "User registered successfully")
+	utils.SuccessResponse(c, resp, "User registered successfully")
+}
+
+// emailTaken reports whether any account, including a deleted one, uses email
+func emailTaken(email string) bool {
+	var count int64
+	database.DB.Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count)
+	return count > 0
 }
 
 // Login handles user login
@@ -93,30 +153,68 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	email := strings.ToLower(req.Email)
+
+	// Reject attempts while the account or IP is locked out
+	if !h.checkLoginAllowed(c, email, nil) {
+		return
+	}
+
 	// Find user by email
 	var user models.User
-	if err := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&user).Error; err != nil {
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		h.recordLoginFailure(c, email, nil, models.LoginFailureUnknownEmail)
 		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
 		return
 	}
 
 	// Check password
 	if !utils.CheckPassword(user.PasswordHash, req.Password) {
+		h.recordLoginFailure(c, email, &user.ID, models.LoginFailureInvalidPassword)
 		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Email, h.cfg.JWTSecret)
+	// Users with two-factor authentication must also present a code. Their
+	// failure count is only reset once the code is verified.
+	if user.HasTwoFactor() {
+		h.startTwoFactorChallenge(c, &user)
+		return
+	}
+	h.recordLoginSuccess(email)
+
+	// Start a session and issue tokens
+	resp, err := issueSession(c, h.cfg, &user)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
 		return
 	}
 
-	utils.SuccessResponse(c, AuthResponse{
-		Token: token,
-		User:  user.ToResponse(),
-	}, "Login successful")
+	utils.SuccessResponse(c, resp, "Login successful")
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	resp, err := rotateRefreshToken(c, h.cfg, req.RefreshToken)
+	switch {
+	case errors.Is(err, errRefreshTokenReused):
+		utils.ErrorResponse(c, http.StatusUnauthorized, "refresh_token_reused", "Refresh token has already been used, please log in again")
+		return
+	case errors.Is(err, errInvalidRefreshToken):
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_refresh_token", "Invalid or expired refresh token")
+		return
+	case err != nil:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to refresh token")
+		return
+	}
+
+	utils.SuccessResponse(c, resp, "Token refreshed successfully")
 }
 
 // GetMe returns the current authenticated user
@@ -133,5 +231,103 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	utils.SuccessResponse(c, user.ToResponse(), "User retrieved successfully")
+	utils.SuccessResponse(c, user.ToAccountResponse(), "User retrieved successfully")
+}
+
+// Logout revokes the current access token and the session it belongs to
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, exists := middleware.GetClaims(c)
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized", "User not authenticated")
+		return
+	}
+
+	if err := auth.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to log out")
+		return
+	}
+
+	if claims.SessionID != 0 {
+		session := models.Session{ID: claims.SessionID}
+		if err := revokeSession(database.DB, &session); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to log out")
+			return
+		}
+	}
+
+	utils.SuccessResponse(c, nil, "Logged out successfully")
+}
+
+// LogoutAll revokes every token and session of the current user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized", "User not authenticated")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := auth.BumpTokenVersion(tx, userID); err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, userID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to log out")
+		return
+	}
+	auth.ForgetTokenVersion(userID)
+
+	utils.SuccessResponse(c, nil, "Logged out from all devices")
+}
+
+// GetSessions lists the devices the current user is logged in on
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var currentID uint
+	if claims, ok := middleware.GetClaims(c); ok {
+		currentID = claims.SessionID
+	}
+
+	var sessions []models.Session
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC NULLS LAST").
+		Find(&sessions).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch sessions")
+		return
+	}
+
+	responses := make([]models.SessionResponse, len(sessions))
+	for i := range sessions {
+		responses[i] = sessions[i].ToResponse(currentID)
+	}
+
+	utils.SuccessResponse(c, responses, fmt.Sprintf("%d sessions found", len(responses)))
+}
+
+// RevokeSession logs a single device out. Its refresh token stops working
+// and its access tokens are rejected.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&session).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Session not found")
+		return
+	}
+
+	if err := revokeSession(database.DB, &session); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to revoke session")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Session revoked successfully")
+}
+
+// JWKS publishes the public keys tokens can be verified with
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": auth.Keys.JWKS()})
 }
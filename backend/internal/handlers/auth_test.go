@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// Another registration taking the handle between the check and the insert
+func TestRegisterHandleRace(t *testing.T) {
+	db := testdb.Open(t)
+	h := newAuthHandler(t)
+
+	raced := false
+	if err := db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "users" {
+			return
+		}
+		raced = true
+		other := models.User{FirstName: "Other", LastName: "User", Email: "other@example.com", Handle: "alice", Role: models.RoleUser}
+		if err := tx.Session(&gorm.Session{NewDB: true}).Create(&other).Error; err != nil {
+			t.Error(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(t, h.Register, http.MethodPost, "/", RegisterRequest{
+		FirstName: "Alice",
+		LastName:  "Example",
+		Email:     "alice@example.com",
+		Password:  "password",
+		Handle:    "alice",
+	}, 0)
+	if w.Code != http.StatusConflict || errorCode(t, w) != "handle_taken" {
+		t.Errorf("Register = %d %s, want 409 handle_taken", w.Code, w.Body)
+	}
+}
+
+func TestRegisterEmailOfDeletedAccount(t *testing.T) {
+	testdb.Open(t)
+	h := newAuthHandler(t)
+	user := createUser(t, "alice")
+	database.DB.Delete(user)
+
+	w := serve(t, h.Register, http.MethodPost, "/", RegisterRequest{
+		FirstName: "Alice",
+		LastName:  "Again",
+		Email:     user.Email,
+		Password:  "password",
+	}, 0)
+	if w.Code != http.StatusConflict || errorCode(t, w) != "user_exists" {
+		t.Errorf("Register = %d %s, want 409 user_exists", w.Code, w.Body)
+	}
+}
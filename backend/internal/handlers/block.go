@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/timeline"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Block blocks a user. Both users stop following each other, are taken off
+// each other's close friends and neither sees the other's content any more.
+func (h *UserHandler) Block(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+	if user.ID == userID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_request", "You can't block yourself")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		block := models.Block{BlockerID: userID, BlockedID: user.ID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("(follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)",
+			userID, user.ID, user.ID, userID).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
+			userID, user.ID, user.ID, userID).Delete(&models.CloseFriend{}).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to block user")
+		return
+	}
+
+	for _, pair := range [][2]uint{{userID, user.ID}, {user.ID, userID}} {
+		if err := timeline.RemoveAuthor(pair[0], pair[1]); err != nil {
+			log.Printf("Failed to remove user %d from timeline of %d: %v", pair[1], pair[0], err)
+		}
+	}
+
+	utils.SuccessResponse(c, gin.H{"blocked": true}, "User blocked")
+}
+
+// Unblock removes a block. Follows removed by the block aren't restored.
+func (h *UserHandler) Unblock(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("blocker_id = ? AND blocked_id = ?", userID, user.ID).
+		Delete(&models.Block{}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to unblock user")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"blocked": false}, "User unblocked")
+}
+
+// Mute hides a user's posts from the current user's feeds
+func (h *UserHandler) Mute(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+	if user.ID == userID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_request", "You can't mute yourself")
+		return
+	}
+
+	mute := models.Mute{MuterID: userID, MutedID: user.ID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to mute user")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"muted": true}, "User muted")
+}
+
+// Unmute shows a muted user's posts in the current user's feeds again
+func (h *UserHandler) Unmute(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("muter_id = ? AND muted_id = ?", userID, user.ID).
+		Delete(&models.Mute{}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to unmute user")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"muted": false}, "User unmuted")
+}
+
+// GetBlocked lists the users the current user blocked, most recent first
+func (h *UserHandler) GetBlocked(c *gin.Context) {
+	h.listRelated(c, "blocks", "blocker_id", "blocked_id")
+}
+
+// GetMuted lists the users the current user muted, most recent first
+func (h *UserHandler) GetMuted(c *gin.Context) {
+	h.listRelated(c, "mutes", "muter_id", "muted_id")
+}
+
+// listRelated pages through the rows of table whose by column is the
+// current user and returns the users in the other column
+func (h *UserHandler) listRelated(c *gin.Context, table, by, other string) {
+	userID, _ := middleware.GetUserID(c)
+
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
+
+	// The page is over the rows of table, so their ID and creation time
+	// come along with each user for the cursor
+	type relatedUser struct {
+		models.User `gorm:"embedded"`
+		RelationID  uint
+		RelatedAt   time.Time
+	}
+
+	query := database.DB.Model(&models.User{}).
+		Select("users.*, "+table+".id AS relation_id, "+table+".created_at AS related_at").
+		Joins("JOIN "+table+" ON "+table+"."+other+" = users.id").
+		Where(table+"."+by+" = ?", userID)
+
+	var users []relatedUser
+	if err := page.Apply(query, table, false).Find(&users).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch users")
+		return
+	}
+	users, next := utils.NextPage(users, page, func(u *relatedUser) (time.Time, uint) {
+		return u.RelatedAt, u.RelationID
+	})
+
+	responses := make([]models.UserResponse, len(users))
+	for i, u := range users {
+		responses[i] = u.ToResponse()
+	}
+
+	utils.PaginatedSuccessResponse(c, responses, page.Limit, next)
+}
+
+// withoutMuted leaves out content by users the viewer muted
+func withoutMuted(query *gorm.DB, viewerID uint, column string) *gorm.DB {
+	muted := database.DB.Model(&models.Mute{}).Select("muted_id").Where("muter_id = ?", viewerID)
+	return query.Where(column+" NOT IN (?)", muted)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// AddCloseFriend puts a user on the current user's close friends list. The
+// user isn't told.
+func (h *UserHandler) AddCloseFriend(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+	if user.ID == userID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_request", "You can't add yourself to your close friends")
+		return
+	}
+	if user.IsAnonymized() {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+	blocked, err := policy.IsBlocked(userID, user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to add close friend")
+		return
+	}
+	if blocked {
+		utils.ErrorResponse(c, http.StatusForbidden, "blocked", "You can't interact with this user")
+		return
+	}
+
+	friend := models.CloseFriend{UserID: userID, FriendID: user.ID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&friend).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to add close friend")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"close_friend": true}, "Added to close friends")
+}
+
+// RemoveCloseFriend takes a user off the current user's close friends list
+func (h *UserHandler) RemoveCloseFriend(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("user_id = ? AND friend_id = ?", userID, user.ID).
+		Delete(&models.CloseFriend{}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to remove close friend")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"close_friend": false}, "Removed from close friends")
+}
+
+// GetCloseFriends lists the current user's close friends, most recently
+// added first
+func (h *UserHandler) GetCloseFriends(c *gin.Context) {
+	h.listRelated(c, "close_friends", "user_id", "friend_id")
+}
@@ -1,15 +1,18 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/counters"
 	"github.com/applifylab/social-feed-backend/internal/database"
 	"github.com/applifylab/social-feed-backend/internal/middleware"
 	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
 	"github.com/applifylab/social-feed-backend/internal/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CommentHandler struct {
@@ -35,10 +38,8 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		return
 	}
 
-	// Check if post exists
-	var post models.Post
-	if err := database.DB.First(&post, postID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Post not found")
+	post, ok := authorizePost(c, policy.Comment, postID)
+	if !ok {
 		return
 	}
 
@@ -48,7 +49,7 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		Content: req.Content,
 	}
 
-	if err := database.DB.Create(&comment).Error; err != nil {
+	if err := createComment(&comment); err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create comment")
 		return
 	}
@@ -57,42 +58,40 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 	utils.SuccessResponse(c, comment.ToResponse(), "Comment created successfully")
 }
 
-// GetComments retrieves comments for a post
+// GetComments retrieves comments for a post, newest first
 func (h *CommentHandler) GetComments(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
-	postID := c.Param("id")
+
+	post, ok := authorizePost(c, policy.View, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Where("post_id = ? AND parent_comment_id IS NULL", post.ID)
+	query = policy.Comments(query, viewer(c))
 
 	var comments []models.Comment
-	if err := database.DB.Where("post_id = ? AND parent_comment_id IS NULL", postID).
+	if err := page.Apply(query, "comments", false).
 		Preload("User").
-		Order("created_at DESC").
 		Find(&comments).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch comments")
 		return
 	}
+	comments, next := utils.NextPage(comments, page, commentKey)
 
-	// Enrich with counts
-	for i := range comments {
-		database.DB.Model(&models.Like{}).
-			Where("likeable_type = ? AND likeable_id = ?", "comment", comments[i].ID).
-			Count(&comments[i].LikesCount)
-
-		database.DB.Model(&models.Comment{}).
-			Where("parent_comment_id = ?", comments[i].ID).
-			Count(&comments[i].RepliesCount)
-
-		var like models.Like
-		err := database.DB.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?",
-			userID, "comment", comments[i].ID).First(&like).Error
-		comments[i].IsLiked = err == nil
-	}
+	enrichComments(userID, comments)
 
 	commentResponses := make([]models.CommentResponse, len(comments))
 	for i, comment := range comments {
 		commentResponses[i] = comment.ToResponse()
 	}
 
-	utils.SuccessResponse(c, commentResponses, fmt.Sprintf("%d comments found", len(comments)))
+	utils.PaginatedSuccessResponse(c, commentResponses, page.Limit, next)
 }
 
 // CreateReply creates a reply to a comment
@@ -106,10 +105,8 @@ func (h *CommentHandler) CreateReply(c *gin.Context) {
 		return
 	}
 
-	// Check if parent comment exists
-	var parentComment models.Comment
-	if err := database.DB.First(&parentComment, commentID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Comment not found")
+	_, parentComment, ok := authorizeComment(c, policy.Comment, commentID)
+	if !ok {
 		return
 	}
 
@@ -120,7 +117,7 @@ func (h *CommentHandler) CreateReply(c *gin.Context) {
 		Content:         req.Content,
 	}
 
-	if err := database.DB.Create(&reply).Error; err != nil {
+	if err := createComment(&reply); err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create reply")
 		return
 	}
@@ -129,38 +126,40 @@ func (h *CommentHandler) CreateReply(c *gin.Context) {
 	utils.SuccessResponse(c, reply.ToResponse(), "Reply created successfully")
 }
 
-// GetReplies retrieves replies for a comment
+// GetReplies retrieves replies for a comment, oldest first
 func (h *CommentHandler) GetReplies(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
-	commentID := c.Param("id")
+
+	_, comment, ok := authorizeComment(c, policy.View, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Where("parent_comment_id = ?", comment.ID)
+	query = policy.Comments(query, viewer(c))
 
 	var replies []models.Comment
-	if err := database.DB.Where("parent_comment_id = ?", commentID).
+	if err := page.Apply(query, "comments", true).
 		Preload("User").
-		Order("created_at ASC").
 		Find(&replies).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch replies")
 		return
 	}
+	replies, next := utils.NextPage(replies, page, commentKey)
 
-	// Enrich with counts
-	for i := range replies {
-		database.DB.Model(&models.Like{}).
-			Where("likeable_type = ? AND likeable_id = ?", "comment", replies[i].ID).
-			Count(&replies[i].LikesCount)
-
-		var like models.Like
-		err := database.DB.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?",
-			userID, "comment", replies[i].ID).First(&like).Error
-		replies[i].IsLiked = err == nil
-	}
+	enrichComments(userID, replies)
 
 	replyResponses := make([]models.CommentResponse, len(replies))
 	for i, reply := range replies {
 		replyResponses[i] = reply.ToResponse()
 	}
 
-	utils.SuccessResponse(c, replyResponses, fmt.Sprintf("%d replies found", len(replies)))
+	utils.PaginatedSuccessResponse(c, replyResponses, page.Limit, next)
 }
 
 // DeleteComment deletes a comment
@@ -168,19 +167,31 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 	commentID := c.Param("id")
 
-	var comment models.Comment
-	if err := database.DB.First(&comment, commentID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Comment not found")
+	_, comment, ok := authorizeComment(c, policy.Delete, commentID)
+	if !ok {
 		return
 	}
+	asModerator := comment.UserID != userID
 
-	// Check ownership
-	if comment.UserID != userID {
-		utils.ErrorResponse(c, http.StatusForbidden, "forbidden", "You can only delete your own comments")
-		return
-	}
-
-	if err := database.DB.Delete(&comment).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(comment)
+		if result.Error != nil {
+			return result.Error
+		}
+		// Already deleted by a concurrent request
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := counters.AddComments(tx, comment, -1); err != nil {
+			return err
+		}
+		if asModerator {
+			return recordModerationAction(tx, userID, models.ModerationActionDelete,
+				models.ModerationTargetComment, comment.ID, comment.UserID, c.Query("reason"))
+		}
+		return nil
+	})
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to delete comment")
 		return
 	}
@@ -191,51 +202,46 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 // ToggleLike toggles like on a comment
 func (h *CommentHandler) ToggleLike(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
-	commentID := c.Param("id")
 
-	// Check if comment exists
-	var comment models.Comment
-	if err := database.DB.First(&comment, commentID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Comment not found")
+	_, comment, ok := authorizeComment(c, policy.Like, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	// Check if already liked
-	var like models.Like
-	err := database.DB.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?",
-		userID, "comment", commentID).First(&like).Error
+	liked, err := toggleLike(userID, "comment", comment.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update like")
+		return
+	}
 
-	if err == nil {
-		// Unlike
-		database.DB.Delete(&like)
-		utils.SuccessResponse(c, gin.H{"liked": false}, "Comment unliked")
-	} else {
-		// Like
-		like = models.Like{
-			UserID:       userID,
-			LikeableType: "comment",
-			LikeableID:   comment.ID,
-		}
-		database.DB.Create(&like)
+	if liked {
 		utils.SuccessResponse(c, gin.H{"liked": true}, "Comment liked")
+	} else {
+		utils.SuccessResponse(c, gin.H{"liked": false}, "Comment unliked")
 	}
 }
 
-// GetCommentLikes retrieves users who liked a comment
+// GetCommentLikes retrieves users who liked a comment, most recent first
 func (h *CommentHandler) GetCommentLikes(c *gin.Context) {
-	commentID := c.Param("id")
-
-	var likes []models.Like
-	if err := database.DB.Where("likeable_type = ? AND likeable_id = ?", "comment", commentID).
-		Preload("User").Find(&likes).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch likes")
+	_, comment, ok := authorizeComment(c, policy.View, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	users := make([]models.UserResponse, len(likes))
-	for i, like := range likes {
-		users[i] = like.User.ToResponse()
-	}
+	listLikes(c, "comment", comment.ID)
+}
+
+// createComment saves a new comment or reply and counts it on its post or
+// parent comment
+func createComment(comment *models.Comment) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		return counters.AddComments(tx, comment, 1)
+	})
+}
 
-	utils.SuccessResponse(c, users, fmt.Sprintf("%d users liked this comment", len(users)))
+func commentKey(cm *models.Comment) (time.Time, uint) {
+	return cm.CreatedAt, cm.ID
 }
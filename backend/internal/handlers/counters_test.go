@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/counters"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+)
+
+// counts are the counters stored on a post or comment
+type counts struct {
+	Likes    int64
+	Comments int64
+	Replies  int64
+}
+
+func postCounts(t *testing.T, id uint) counts {
+	t.Helper()
+
+	var post models.Post
+	if err := database.DB.Unscoped().First(&post, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return counts{Likes: post.LikesCount, Comments: post.CommentsCount}
+}
+
+func commentCounts(t *testing.T, id uint) counts {
+	t.Helper()
+
+	var comment models.Comment
+	if err := database.DB.Unscoped().First(&comment, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return counts{Likes: comment.LikesCount, Replies: comment.RepliesCount}
+}
+
+// Likes, comments, replies and deletes made through the API keep every
+// counter equal to the rows it counts
+func TestCountersFollowWrites(t *testing.T) {
+	testdb.Open(t)
+	cfg := testConfig(t)
+	posts, comments := NewPostHandler(cfg), NewCommentHandler(cfg)
+	author := createUser(t, "author")
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+	post := createFeedPost(t, author, 0, models.VisibilityPublic, 0)
+
+	// do runs a request that must succeed on the post or comment with the
+	// given ID and returns the ID of what it created, if anything
+	do := func(handler gin.HandlerFunc, method string, body interface{}, user *models.User, target uint) uint {
+		t.Helper()
+		w := serve(t, handler, method, "/", body, user.ID, "id", strconv.FormatUint(uint64(target), 10))
+		if method == http.MethodDelete {
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			return 0
+		}
+		var created struct {
+			ID uint `json:"id"`
+		}
+		decode(t, w, &created)
+		return created.ID
+	}
+	like, likeComment := posts.ToggleLike, comments.ToggleLike
+	comment, reply, deleteComment := comments.CreateComment, comments.CreateReply, comments.DeleteComment
+	check := func(step string, got, want counts) {
+		t.Helper()
+		if got != want {
+			t.Errorf("after %s: counts = %+v, want %+v", step, got, want)
+		}
+	}
+
+	do(like, http.MethodPost, nil, alice, post.ID)
+	do(like, http.MethodPost, nil, bob, post.ID)
+	check("two likes", postCounts(t, post.ID), counts{Likes: 2})
+	do(like, http.MethodPost, nil, alice, post.ID)
+	check("unlike", postCounts(t, post.ID), counts{Likes: 1})
+
+	first := do(comment, http.MethodPost, CreateCommentRequest{Content: "First"}, alice, post.ID)
+	second := do(comment, http.MethodPost, CreateCommentRequest{Content: "Second"}, bob, post.ID)
+	check("two comments", postCounts(t, post.ID), counts{Likes: 1, Comments: 2})
+
+	// Replies count on their parent, not on the post
+	answer := do(reply, http.MethodPost, CreateCommentRequest{Content: "Reply"}, bob, first)
+	check("reply", commentCounts(t, first), counts{Replies: 1})
+	check("reply", postCounts(t, post.ID), counts{Likes: 1, Comments: 2})
+
+	do(likeComment, http.MethodPost, nil, alice, second)
+	do(likeComment, http.MethodPost, nil, author, second)
+	do(likeComment, http.MethodPost, nil, alice, answer)
+	check("comment likes", commentCounts(t, second), counts{Likes: 2})
+	do(likeComment, http.MethodPost, nil, alice, second)
+	check("comment unlike", commentCounts(t, second), counts{Likes: 1})
+	check("reply like", commentCounts(t, answer), counts{Likes: 1})
+
+	do(deleteComment, http.MethodDelete, nil, bob, answer)
+	check("deleting the reply", commentCounts(t, first), counts{})
+	do(deleteComment, http.MethodDelete, nil, bob, second)
+	check("deleting a comment", postCounts(t, post.ID), counts{Likes: 1, Comments: 1})
+
+	// Nothing is left for Reconcile to repair
+	fixedPosts, fixedComments, err := counters.Reconcile(database.DB, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixedPosts != 0 || fixedComments != 0 {
+		t.Errorf("Reconcile fixed %d posts and %d comments, want none", fixedPosts, fixedComments)
+	}
+}
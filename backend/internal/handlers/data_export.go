@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// dataExportInterval is how often a user may request a data export
+const dataExportInterval = 24 * time.Hour
+
+// DownloadDataExportRequest carries the token from the emailed link. The
+// frontend page the link opens posts it as a form, so the browser saves the
+// archive.
+type DownloadDataExportRequest struct {
+	Token string `form:"token" json:"token" binding:"required"`
+}
+
+// RequestDataExport queues an archive of the current user's data. The user
+// is emailed a download link once it is ready.
+func (h *AuthHandler) RequestDataExport(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var recent int64
+	database.DB.Model(&models.DataExport{}).
+		Where("user_id = ? AND (status IN ? OR created_at > ?)", userID,
+			[]string{models.DataExportPending, models.DataExportProcessing}, time.Now().Add(-dataExportInterval)).
+		Count(&recent)
+	if recent > 0 {
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "export_limit",
+			fmt.Sprintf("You can request one data export every %s", dataExportInterval))
+		return
+	}
+
+	export := models.DataExport{
+		UserID: userID,
+		Status: models.DataExportPending,
+	}
+	if err := database.DB.Create(&export).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to request data export")
+		return
+	}
+
+	utils.SuccessResponse(c, export, "Data export requested. You'll get an email when it is ready")
+}
+
+// GetDataExports lists the current user's data exports, newest first
+func (h *AuthHandler) GetDataExports(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var exports []models.DataExport
+	if err := database.DB.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&exports).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch data exports")
+		return
+	}
+
+	utils.SuccessResponse(c, exports, fmt.Sprintf("%d data exports found", len(exports)))
+}
+
+// DownloadDataExport serves an export archive. The token from the emailed
+// link authorizes it, so no Authorization header is needed. It is taken from
+// the body rather than the URL to keep it out of request logs.
+func (h *AuthHandler) DownloadDataExport(c *gin.Context) {
+	var req DownloadDataExportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var export models.DataExport
+	if err := database.DB.Where("token_hash = ? AND status = ?", utils.HashToken(req.Token), models.DataExportReady).
+		First(&export).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Export not found")
+		return
+	}
+	if export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		utils.ErrorResponse(c, http.StatusGone, "export_expired", "This download link has expired")
+		return
+	}
+
+	c.FileAttachment(export.FilePath, fmt.Sprintf("data-export-%d.zip", export.ID))
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// createReadyExport stores a finished export that expires at expiresAt and
+// returns its download token
+func createReadyExport(t *testing.T, user *models.User, expiresAt time.Time) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "export.zip")
+	if err := os.WriteFile(filePath, []byte("archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.GenerateRandomToken(userTokenBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.DataExport{
+		UserID:    user.ID,
+		Status:    models.DataExportReady,
+		FilePath:  filePath,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: &expiresAt,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestDownloadDataExport(t *testing.T) {
+	testdb.Open(t)
+	h := newAuthHandler(t)
+	user := createUser(t, "alice")
+	token := createReadyExport(t, user, time.Now().Add(time.Hour))
+
+	w := serve(t, h.DownloadDataExport, http.MethodPost, "/", DownloadDataExportRequest{Token: token}, 0)
+	if w.Code != http.StatusOK || w.Body.String() != "archive" {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("Content-Disposition = %q, want an attachment", w.Header().Get("Content-Disposition"))
+	}
+
+	w = serve(t, h.DownloadDataExport, http.MethodPost, "/", DownloadDataExportRequest{Token: "wrong"}, 0)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("wrong token status = %d, want 404", w.Code)
+	}
+}
+
+// The frontend page posts the token as a form so the browser saves the file
+func TestDownloadDataExportForm(t *testing.T) {
+	testdb.Open(t)
+	h := newAuthHandler(t)
+	user := createUser(t, "alice")
+	token := createReadyExport(t, user, time.Now().Add(time.Hour))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.DownloadDataExport(c)
+
+	if w.Code != http.StatusOK || w.Body.String() != "archive" {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body)
+	}
+}
+
+func TestDownloadExpiredDataExport(t *testing.T) {
+	testdb.Open(t)
+	h := newAuthHandler(t)
+	user := createUser(t, "alice")
+	token := createReadyExport(t, user, time.Now().Add(-time.Minute))
+
+	w := serve(t, h.DownloadDataExport, http.MethodPost, "/", DownloadDataExportRequest{Token: token}, 0)
+	if w.Code != http.StatusGone {
+		t.Errorf("status = %d, want 410", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errEmailTaken = errors.New("email already in use")
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangeEmail starts an email change by sending a confirmation link to the
+// new address. The account keeps its current email until the link is used.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	newEmail := strings.ToLower(req.NewEmail)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if !utils.CheckPassword(user.PasswordHash, req.Password) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Password is incorrect")
+		return
+	}
+
+	if newEmail == user.Email {
+		utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "New email must be different from the current one")
+		return
+	}
+
+	var existingUser models.User
+	if err := database.DB.Unscoped().Where("email = ?", newEmail).First(&existingUser).Error; err == nil {
+		utils.ErrorResponse(c, http.StatusConflict, "user_exists", "User with this email already exists")
+		return
+	}
+
+	token, err := createUserTokenWithData(database.DB, user.ID, models.TokenPurposeEmailChange, newEmail, h.cfg.EmailChangeTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create confirmation token")
+		return
+	}
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", h.cfg.AppURL, url.QueryEscape(token))
+	h.sendEmail(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to start using this address for your account. It expires in %s.\n\n%s\n",
+			user.FirstName, h.cfg.EmailChangeTTL, link),
+	})
+	h.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is about to change",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your account to %s. If this wasn't you, change your password now.\n",
+			user.FirstName, newEmail),
+	})
+
+	utils.SuccessResponse(c, nil, "Confirmation link sent to the new email address")
+}
+
+// ConfirmEmailChange swaps in the new email address once it has been confirmed
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposeEmailChange)
+		if err != nil {
+			return err
+		}
+		user = token.User
+
+		now := time.Now()
+		err = tx.Model(&user).Updates(map[string]interface{}{
+			"email":             token.Data,
+			"email_verified_at": now,
+		}).Error
+		if database.IsUniqueViolation(err) {
+			return errEmailTaken
+		}
+		user.Email = token.Data
+		user.EmailVerifiedAt = &now
+		return err
+	})
+	switch {
+	case errors.Is(err, errInvalidUserToken):
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_token", "Invalid or expired confirmation token")
+		return
+	case errors.Is(err, errAccountDeleted):
+		accountDeletedResponse(c)
+		return
+	case errors.Is(err, errEmailTaken):
+		utils.ErrorResponse(c, http.StatusConflict, "user_exists", "User with this email already exists")
+		return
+	case err != nil:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to change email")
+		return
+	}
+
+	utils.SuccessResponse(c, user.ToAccountResponse(), "Email changed successfully")
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/timeline"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetHomeFeed retrieves the current user's home timeline: their own posts
+// and those of the users they follow, most recent first
+func (h *PostHandler) GetHomeFeed(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
+
+	posts, err := timeline.Home(userID, page, func(query *gorm.DB) *gorm.DB {
+		query = policy.Posts(query, viewer(c))
+		return withoutMuted(query, userID, "posts.user_id").Preload("User")
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch feed")
+		return
+	}
+	posts, next := utils.NextPage(posts, page, postKey)
+
+	enrichPosts(userID, posts)
+
+	postResponses := make([]models.PostResponse, len(posts))
+	for i, post := range posts {
+		postResponses[i] = post.ToResponse()
+	}
+
+	utils.PaginatedSuccessResponse(c, postResponses, page.Limit, next)
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/applifylab/social-feed-backend/internal/timeline"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+)
+
+// feedStart is when the first post of a test feed is created
+var feedStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// createFeedPost stores a post created minute minutes after feedStart and
+// fans it out to followers unless its author has more than maxFollowers
+func createFeedPost(t testing.TB, author *models.User, minute int, visibility string, maxFollowers int) *models.Post {
+	t.Helper()
+
+	post := models.Post{
+		UserID:     author.ID,
+		Content:    fmt.Sprintf("%s at %d", author.Handle, minute),
+		Visibility: visibility,
+		CreatedAt:  feedStart.Add(time.Duration(minute) * time.Minute),
+	}
+	if err := database.DB.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := timeline.FanOut(&post, maxFollowers); err != nil {
+		t.Fatal(err)
+	}
+	return &post
+}
+
+func follow(t testing.TB, follower, followee *models.User) {
+	t.Helper()
+
+	if err := database.DB.Create(&models.Follow{FollowerID: follower.ID, FolloweeID: followee.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type feedPage struct {
+	Data []struct {
+		ID uint `json:"id"`
+	} `json:"data"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// readHomeFeed follows the cursor through the whole home feed of the user
+// and returns the IDs of its posts in order
+func readHomeFeed(t testing.TB, h *PostHandler, user *models.User, limit int) []uint {
+	t.Helper()
+
+	var ids []uint
+	cursor := ""
+	for {
+		target := fmt.Sprintf("/?limit=%d&cursor=%s", limit, url.QueryEscape(cursor))
+		w := serve(t, h.GetHomeFeed, http.MethodGet, target, nil, user.ID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GetHomeFeed status = %d: %s", w.Code, w.Body)
+		}
+
+		var page feedPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range page.Data {
+			ids = append(ids, post.ID)
+		}
+		if !page.HasMore {
+			return ids
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func TestGetHomeFeed(t *testing.T) {
+	testdb.Open(t)
+	h := NewPostHandler(testConfig(t))
+
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+	celebrity := createUser(t, "celebrity")
+	muted := createUser(t, "muted")
+	stranger := createUser(t, "stranger")
+	for _, followee := range []*models.User{bob, celebrity, muted} {
+		follow(t, alice, followee)
+	}
+	database.DB.Create(&models.Mute{MuterID: alice.ID, MutedID: muted.ID})
+
+	// The celebrity's posts aren't fanned out, so they are merged in on read
+	const maxFollowers, popular = 10, 0
+
+	var want []uint
+	add := func(post *models.Post) { want = append(want, post.ID) }
+
+	add(createFeedPost(t, alice, 0, models.VisibilityPublic, maxFollowers))
+	add(createFeedPost(t, bob, 1, models.VisibilityPublic, maxFollowers))
+	add(createFeedPost(t, celebrity, 2, models.VisibilityPublic, popular))
+	add(createFeedPost(t, bob, 3, models.VisibilityFollowers, maxFollowers))
+	createFeedPost(t, bob, 4, models.VisibilityOnlyMe, maxFollowers)
+	createFeedPost(t, muted, 5, models.VisibilityPublic, maxFollowers)
+	createFeedPost(t, stranger, 6, models.VisibilityPublic, maxFollowers)
+	add(createFeedPost(t, celebrity, 7, models.VisibilityPublic, popular))
+	add(createFeedPost(t, alice, 7, models.VisibilityOnlyMe, maxFollowers))
+	add(createFeedPost(t, bob, 7, models.VisibilityPublic, maxFollowers))
+	hidden := createFeedPost(t, bob, 8, models.VisibilityPublic, maxFollowers)
+	database.DB.Model(hidden).Update("hidden_at", time.Now())
+	add(createFeedPost(t, celebrity, 9, models.VisibilityPublic, popular))
+
+	// Newest first, with posts created at the same time ordered by ID
+	slices.SortFunc(want, func(a, b uint) int {
+		var pa, pb models.Post
+		database.DB.First(&pa, a)
+		database.DB.First(&pb, b)
+		if c := pb.CreatedAt.Compare(pa.CreatedAt); c != 0 {
+			return c
+		}
+		return int(b) - int(a)
+	})
+
+	for _, limit := range []int{1, 2, 3, 20} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			if got := readHomeFeed(t, h, alice, limit); !slices.Equal(got, want) {
+				t.Errorf("feed = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// BenchmarkGetHomeFeed reads the home feed of a user following tens of
+// thousands of accounts, a few of them popular enough to be merged in on
+// read. Run it with
+//
+//	go test ./internal/handlers -run '^$' -bench GetHomeFeed
+func BenchmarkGetHomeFeed(b *testing.B) {
+	const (
+		followees = 20000
+		popular   = 20
+		batchSize = 1000
+	)
+
+	testdb.Open(b)
+	h := NewPostHandler(testConfig(b))
+	viewer := createUser(b, "viewer")
+
+	users := make([]models.User, followees)
+	for i := range users {
+		handle := fmt.Sprintf("author%d", i)
+		users[i] = models.User{FirstName: "Author", LastName: handle, Handle: handle, Email: handle + "@example.com", Role: models.RoleUser}
+	}
+	if err := database.DB.CreateInBatches(users, batchSize).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	follows := make([]models.Follow, followees)
+	posts := make([]models.Post, followees)
+	for i, user := range users {
+		follows[i] = models.Follow{FollowerID: viewer.ID, FolloweeID: user.ID}
+		posts[i] = models.Post{
+			UserID:     user.ID,
+			Content:    "Hello",
+			Visibility: models.VisibilityPublic,
+			FannedOut:  i >= popular,
+			CreatedAt:  feedStart.Add(time.Duration(i) * time.Second),
+		}
+	}
+	if err := database.DB.CreateInBatches(follows, batchSize).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := database.DB.CreateInBatches(posts, batchSize).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	var entries []models.TimelineEntry
+	for _, post := range posts[popular:] {
+		entries = append(entries, models.TimelineEntry{UserID: viewer.ID, PostID: post.ID, AuthorID: post.UserID, CreatedAt: post.CreatedAt})
+	}
+	if err := database.DB.CreateInBatches(entries, batchSize).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	// A page in the middle of the timeline, as reached by scrolling
+	middle := posts[followees/2]
+	deep := url.QueryEscape(utils.Cursor{CreatedAt: middle.CreatedAt, ID: middle.ID}.Encode())
+
+	for name, target := range map[string]string{
+		"first page": "/?limit=20",
+		"deep page":  "/?limit=20&cursor=" + deep,
+	} {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				if w := serve(b, h.GetHomeFeed, http.MethodGet, target, nil, viewer.ID); w.Code != http.StatusOK {
+					b.Fatalf("GetHomeFeed status = %d: %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/timeline"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// Follow makes the current user follow another user. Following someone
+// twice is not an error.
+func (h *UserHandler) Follow(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+	if user.ID == userID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_request", "You can't follow yourself")
+		return
+	}
+	if user.IsAnonymized() {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+	blocked, err := policy.IsBlocked(userID, user.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to follow user")
+		return
+	}
+	if blocked {
+		utils.ErrorResponse(c, http.StatusForbidden, "blocked", "You can't interact with this user")
+		return
+	}
+
+	follow := models.Follow{FollowerID: userID, FolloweeID: user.ID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to follow user")
+		return
+	}
+
+	// Their recent posts show up on the home timeline straight away
+	if err := timeline.AddAuthor(userID, user.ID); err != nil {
+		log.Printf("Failed to add user %d to timeline of %d: %v", user.ID, userID, err)
+	}
+
+	utils.SuccessResponse(c, gin.H{"following": true}, "User followed")
+}
+
+// Unfollow stops the current user following another user
+func (h *UserHandler) Unfollow(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("follower_id = ? AND followee_id = ?", userID, user.ID).
+		Delete(&models.Follow{}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to unfollow user")
+		return
+	}
+	if err := timeline.RemoveAuthor(userID, user.ID); err != nil {
+		log.Printf("Failed to remove user %d from timeline of %d: %v", user.ID, userID, err)
+	}
+
+	utils.SuccessResponse(c, gin.H{"following": false}, "User unfollowed")
+}
+
+// GetFollowers lists the users following a user, most recent first
+func (h *UserHandler) GetFollowers(c *gin.Context) {
+	h.listFollows(c, "followee_id", "follower_id")
+}
+
+// GetFollowing lists the users a user follows, most recent first
+func (h *UserHandler) GetFollowing(c *gin.Context) {
+	h.listFollows(c, "follower_id", "followee_id")
+}
+
+// listFollows pages through the follows whose by column is the requested
+// user and returns the users in the other column
+func (h *UserHandler) listFollows(c *gin.Context, by, other string) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findVisibleUser(c, userID)
+	if !ok {
+		return
+	}
+
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Model(&models.Follow{}).Where(by+" = ?", user.ID)
+	query = policy.WithoutDeletedUsers(query, other)
+
+	var follows []models.Follow
+	if err := page.Apply(query, "follows", false).
+		Preload("Follower").
+		Preload("Followee").
+		Find(&follows).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch users")
+		return
+	}
+	follows, next := utils.NextPage(follows, page, func(f *models.Follow) (time.Time, uint) {
+		return f.CreatedAt, f.ID
+	})
+
+	users := make([]*models.User, len(follows))
+	for i := range follows {
+		if other == "follower_id" {
+			users[i] = &follows[i].Follower
+		} else {
+			users[i] = &follows[i].Followee
+		}
+	}
+	markFollowed(userID, users...)
+
+	responses := make([]models.UserResponse, len(users))
+	for i, u := range users {
+		responses[i] = u.ToResponse()
+	}
+
+	utils.PaginatedSuccessResponse(c, responses, page.Limit, next)
+}
+
+// findUserByHandle loads the user named by the :handle route parameter,
+// responding with 404 if there is none
+func findUserByHandle(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := database.DB.Where("handle = ?", strings.ToLower(c.Param("handle"))).First(&user).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return nil, false
+	}
+	return &user, true
+}
+
+// findVisibleUser is findUserByHandle for routes that show a user's profile
+// or connections: users who blocked the viewer look like they don't exist
+func findVisibleUser(c *gin.Context, viewerID uint) (*models.User, bool) {
+	user, ok := findUserByHandle(c)
+	if !ok {
+		return nil, false
+	}
+
+	var blockedBy int64
+	if err := database.DB.Model(&models.Block{}).
+		Where("blocker_id = ? AND blocked_id = ?", user.ID, viewerID).
+		Count(&blockedBy).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch user")
+		return nil, false
+	}
+	if blockedBy > 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// markFollowed sets IsFollowing on the users the viewer follows
+func markFollowed(viewerID uint, users ...*models.User) {
+	if len(users) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+
+	var followed []uint
+	database.DB.Model(&models.Follow{}).
+		Where("follower_id = ? AND followee_id IN ?", viewerID, ids).
+		Pluck("followee_id", &followed)
+
+	set := make(map[uint]bool, len(followed))
+	for _, id := range followed {
+		set[id] = true
+	}
+	for _, u := range users {
+		u.IsFollowing = set[u.ID]
+	}
+}
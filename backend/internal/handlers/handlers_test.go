@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testConfig returns the configuration handlers are tested with and loads
+// its signing keys
+func testConfig(t testing.TB) *config.Config {
+	t.Helper()
+
+	cfg := &config.Config{
+		AppName:              "Social Feed",
+		AppURL:               "http://localhost:3000",
+		PublicURL:            "http://localhost:8080",
+		JWTSecret:            "test-secret",
+		JWTAlgorithm:         "HS256",
+		AccessTokenTTL:       15 * time.Minute,
+		RefreshTokenTTL:      24 * time.Hour,
+		WebAuthnRPID:         "localhost",
+		UnverifiedUserPolicy: config.PolicyAllow,
+	}
+	if err := auth.LoadKeys(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// discardMailer drops every email
+type discardMailer struct{}
+
+func (discardMailer) Send(mailer.Message) error { return nil }
+
+func newAuthHandler(t testing.TB) *AuthHandler {
+	t.Helper()
+	return NewAuthHandler(testConfig(t), discardMailer{})
+}
+
+// createUser stores a verified user with the given handle
+func createUser(t testing.TB, handle string) *models.User {
+	t.Helper()
+
+	now := time.Now()
+	user := models.User{
+		FirstName:       "Test",
+		LastName:        handle,
+		Handle:          handle,
+		Email:           handle + "@example.com",
+		EmailVerifiedAt: &now,
+		Role:            models.RoleUser,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// serve runs a handler for a request made by userID, or anonymously if it
+// is 0, and returns the recorded response. params fills in path parameters
+// in order, e.g. "id", "42".
+func serve(t testing.TB, handler gin.HandlerFunc, method, target string, body interface{}, userID uint, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, reader)
+	c.Request.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		var role string
+		database.DB.Unscoped().Model(&models.User{}).Select("role").Where("id = ?", userID).Scan(&role)
+		c.Set("user_id", userID)
+		c.Set("role", role)
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		c.Params = append(c.Params, gin.Param{Key: params[i], Value: params[i+1]})
+	}
+
+	handler(c)
+	return w
+}
+
+// decode unmarshals the data of a successful response into v
+func decode(t testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		t.Fatal(fmt.Errorf("decoding %s: %w", resp.Data, err))
+	}
+}
+
+// errorCode returns the error code of a failed response
+func errorCode(t testing.TB, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Error
+}
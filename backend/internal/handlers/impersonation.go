@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type ImpersonateRequest struct {
+	Reason      string `json:"reason" binding:"required,max=500"`
+	AllowWrites bool   `json:"allow_writes"`
+}
+
+type ImpersonateResponse struct {
+	Token         string                 `json:"token"`
+	ExpiresIn     int64                  `json:"expires_in"`
+	Impersonation models.Impersonation   `json:"impersonation"`
+	User          models.AccountResponse `json:"user"`
+}
+
+// Impersonate issues a short-lived access token for acting as another user.
+// The token is read-only unless allow_writes is set, never allows deletes
+// and every request made with it is audited.
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	adminID, _ := middleware.GetUserID(c)
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+
+	if user.ID == adminID {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_request", "You can't impersonate yourself")
+		return
+	}
+	if user.Role == models.RoleAdmin {
+		utils.ErrorResponse(c, http.StatusForbidden, "forbidden", "Admins can't be impersonated")
+		return
+	}
+
+	claims := &utils.Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		EmailVerified:  user.IsEmailVerified(),
+		Role:           user.Role,
+		TokenVersion:   user.TokenVersion,
+		ImpersonatorID: adminID,
+		ReadOnly:       !req.AllowWrites,
+	}
+	token, err := utils.GenerateToken(claims, auth.Keys, h.cfg.ImpersonateTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	impersonation := models.Impersonation{
+		AdminID:     adminID,
+		UserID:      user.ID,
+		Reason:      req.Reason,
+		AllowWrites: req.AllowWrites,
+		TokenID:     claims.ID,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}
+	if err := database.DB.Create(&impersonation).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start impersonation")
+		return
+	}
+
+	utils.SuccessResponse(c, ImpersonateResponse{
+		Token:         token,
+		ExpiresIn:     int64(h.cfg.ImpersonateTTL.Seconds()),
+		Impersonation: impersonation,
+		User:          user.ToAccountResponse(),
+	}, "Impersonation started")
+}
+
+// EndImpersonation revokes an impersonation token before it expires
+func (h *AdminHandler) EndImpersonation(c *gin.Context) {
+	var impersonation models.Impersonation
+	if err := database.DB.First(&impersonation, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Impersonation not found")
+		return
+	}
+
+	now := time.Now()
+	if impersonation.EndedAt != nil || now.After(impersonation.ExpiresAt) {
+		utils.SuccessResponse(c, nil, "Impersonation already ended")
+		return
+	}
+
+	if err := auth.RevokeToken(impersonation.TokenID, impersonation.UserID, impersonation.ExpiresAt); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to end impersonation")
+		return
+	}
+	database.DB.Model(&impersonation).Update("ended_at", now)
+
+	utils.SuccessResponse(c, nil, "Impersonation ended")
+}
+
+// GetImpersonations lists impersonations, newest first. Filter with the
+// admin_id and user_id query parameters.
+func (h *AdminHandler) GetImpersonations(c *gin.Context) {
+	page, ok := utils.ParsePage(c, 50)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Model(&models.Impersonation{})
+	if adminID := c.Query("admin_id"); adminID != "" {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var impersonations []models.Impersonation
+	if err := page.Apply(query, "impersonations", false).Find(&impersonations).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch impersonations")
+		return
+	}
+	impersonations, next := utils.NextPage(impersonations, page, func(i *models.Impersonation) (time.Time, uint) {
+		return i.CreatedAt, i.ID
+	})
+
+	utils.PaginatedSuccessResponse(c, impersonations, page.Limit, next)
+}
+
+// GetImpersonatedRequests lists the requests made during an impersonation,
+// oldest first
+func (h *AdminHandler) GetImpersonatedRequests(c *gin.Context) {
+	page, ok := utils.ParsePage(c, 50)
+	if !ok {
+		return
+	}
+
+	var impersonation models.Impersonation
+	if err := database.DB.First(&impersonation, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Impersonation not found")
+		return
+	}
+
+	query := database.DB.Model(&models.ImpersonatedRequest{}).Where("token_id = ?", impersonation.TokenID)
+
+	var requests []models.ImpersonatedRequest
+	if err := page.Apply(query, "impersonated_requests", true).Find(&requests).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch requests")
+		return
+	}
+	requests, next := utils.NextPage(requests, page, func(r *models.ImpersonatedRequest) (time.Time, uint) {
+		return r.CreatedAt, r.ID
+	})
+
+	utils.PaginatedSuccessResponse(c, requests, page.Limit, next)
+}
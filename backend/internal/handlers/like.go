@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"github.com/applifylab/social-feed-backend/internal/counters"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// toggleLike likes a post or comment for the user, or unlikes it if they
+// already did, and keeps its likes count in step. It returns whether the
+// user now likes it.
+func toggleLike(userID uint, likeableType string, likeableID uint) (bool, error) {
+	liked := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?", userID, likeableType, likeableID).
+			Delete(&models.Like{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return counters.AddLikes(tx, likeableType, likeableID, -result.RowsAffected)
+		}
+
+		liked = true
+		if err := tx.Create(&models.Like{
+			UserID:       userID,
+			LikeableType: likeableType,
+			LikeableID:   likeableID,
+		}).Error; err != nil {
+			return err
+		}
+		return counters.AddLikes(tx, likeableType, likeableID, 1)
+	})
+	// A concurrent request liked it first
+	if database.IsUniqueViolation(err) {
+		return true, nil
+	}
+	return liked, err
+}
+
+// likedBy returns which of the posts or comments with ids the user liked
+func likedBy(userID uint, likeableType string, ids []uint) map[uint]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var liked []uint
+	database.DB.Model(&models.Like{}).
+		Where("user_id = ? AND likeable_type = ? AND likeable_id IN ?", userID, likeableType, ids).
+		Pluck("likeable_id", &liked)
+
+	set := make(map[uint]bool, len(liked))
+	for _, id := range liked {
+		set[id] = true
+	}
+	return set
+}
+
+// enrichComments fills in the viewer's likes and follows on a page of
+// comments
+func enrichComments(userID uint, comments []models.Comment) {
+	ids := make([]uint, len(comments))
+	authors := make([]*models.User, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].ID
+		authors[i] = &comments[i].User
+	}
+
+	liked := likedBy(userID, "comment", ids)
+	for i := range comments {
+		comments[i].IsLiked = liked[comments[i].ID]
+	}
+	markFollowed(userID, authors...)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Magic link rate limits per account
+const (
+	magicLinkInterval   = time.Minute
+	magicLinkMaxPerHour = 5
+)
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type RedeemMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RequestMagicLink emails a one-time login link. The response is the same
+// whether or not the email belongs to an account, or the link was withheld
+// because of rate limiting.
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	email := strings.ToLower(req.Email)
+	if !h.checkLoginAllowed(c, email, nil) {
+		return
+	}
+
+	const message = "If an account exists for this email, a login link has been sent"
+
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		utils.SuccessResponse(c, nil, message)
+		return
+	}
+
+	if !magicLinkAllowed(user.ID) {
+		utils.SuccessResponse(c, nil, message)
+		return
+	}
+
+	token, err := createUserToken(database.DB, user.ID, models.TokenPurposeMagicLink, h.cfg.MagicLinkTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create login link")
+		return
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", h.cfg.AppURL, url.QueryEscape(token))
+	h.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to sign in to %s. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.FirstName, h.cfg.AppName, h.cfg.MagicLinkTTL, link),
+	})
+
+	utils.SuccessResponse(c, nil, message)
+}
+
+// RedeemMagicLink exchanges a login link token for the same response as
+// Login. Since the link proves the user owns the address, it also verifies
+// their email.
+func (h *AuthHandler) RedeemMagicLink(c *gin.Context) {
+	var req RedeemMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	// Only the IP can be throttled, the token doesn't tell whose it is
+	if !h.checkLoginAllowed(c, "", nil) {
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposeMagicLink)
+		if err != nil {
+			return err
+		}
+		user = token.User
+
+		if user.IsEmailVerified() {
+			return nil
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		return tx.Model(&user).Update("email_verified_at", now).Error
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		h.recordLoginFailure(c, "", nil, models.LoginFailureInvalidLink)
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_token", "Invalid or expired login link")
+		return
+	}
+	if errors.Is(err, errAccountDeleted) {
+		accountDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to process login link")
+		return
+	}
+
+	// The link replaces the password, not the second factor
+	if user.HasTwoFactor() {
+		h.startTwoFactorChallenge(c, &user)
+		return
+	}
+	h.recordLoginSuccess(user.Email)
+
+	resp, err := issueSession(c, h.cfg, &user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	utils.SuccessResponse(c, resp, "Login successful")
+}
+
+// magicLinkAllowed reports whether another login link may be sent to the user
+func magicLinkAllowed(userID uint) bool {
+	var lastHour, lastInterval int64
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?",
+			userID, models.TokenPurposeMagicLink, time.Now().Add(-time.Hour)).
+		Count(&lastHour)
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?",
+			userID, models.TokenPurposeMagicLink, time.Now().Add(-magicLinkInterval)).
+		Count(&lastInterval)
+
+	return lastHour < magicLinkMaxPerHour && lastInterval == 0
+}
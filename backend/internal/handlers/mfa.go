@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount is the number of backup codes handed out on enrollment
+const recoveryCodeCount = 10
+
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type VerifyTwoFactorRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret    string `json:"secret"`
+	URI       string `json:"otpauth_uri"`
+	QRPayload string `json:"qr_payload"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// SetupTwoFactor generates a new TOTP secret for the current user. Two-factor
+// authentication is only enabled once a code is confirmed.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if user.HasTwoFactor() {
+		utils.ErrorResponse(c, http.StatusConflict, "two_factor_enabled", "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate secret")
+		return
+	}
+
+	if err := database.DB.Model(&user).Update("totp_secret", secret).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to save secret")
+		return
+	}
+
+	uri := utils.TOTPURI(secret, h.cfg.AppName, user.Email)
+	utils.SuccessResponse(c, TwoFactorSetupResponse{
+		Secret:    secret,
+		URI:       uri,
+		QRPayload: uri,
+	}, "Scan the QR code with your authenticator app and confirm with a code")
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves
+// their authenticator works, and returns single-use recovery codes
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if user.HasTwoFactor() {
+		utils.ErrorResponse(c, http.StatusConflict, "two_factor_enabled", "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "two_factor_not_setup", "Start two-factor setup first")
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := useTOTPCode(tx, &user, req.Code); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_code", "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to enable two-factor authentication")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"recovery_codes": codes}, "Two-factor authentication enabled. Store your recovery codes somewhere safe")
+}
+
+// DisableTwoFactor turns off two-factor authentication for the current user
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if !user.HasTwoFactor() {
+		utils.ErrorResponse(c, http.StatusBadRequest, "two_factor_not_enabled", "Two-factor authentication is not enabled")
+		return
+	}
+
+	if !utils.CheckPassword(user.PasswordHash, req.Password) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Password is incorrect")
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// The code may be either a TOTP code or a recovery code
+		if err := useSecondFactor(tx, &user, req.Code, req.Code); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_code", "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to disable two-factor authentication")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Two-factor authentication disabled")
+}
+
+// VerifyTwoFactor completes a two-factor login by exchanging the pending
+// token and a TOTP or recovery code for real tokens
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req VerifyTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Code or recovery code is required")
+		return
+	}
+
+	claims, err := utils.ValidateToken(req.MFAToken, auth.Keys)
+	if err != nil || claims.Purpose != utils.TokenPurposeMFAPending || auth.IsTokenRevoked(claims.ID) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_mfa_token", "Login expired, please sign in again")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID).Error; err != nil || !user.HasTwoFactor() {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_mfa_token", "Login expired, please sign in again")
+		return
+	}
+
+	if !h.checkLoginAllowed(c, user.Email, &user.ID) {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return useSecondFactor(tx, &user, req.Code, req.RecoveryCode)
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		h.recordLoginFailure(c, user.Email, &user.ID, models.LoginFailureInvalidCode)
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_code", "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to verify code")
+		return
+	}
+
+	// The pending token can't be exchanged twice
+	if err := auth.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to verify code")
+		return
+	}
+	h.recordLoginSuccess(user.Email)
+
+	resp, err := issueSession(c, h.cfg, &user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	utils.SuccessResponse(c, resp, "Login successful")
+}
+
+// startTwoFactorChallenge answers a correct password with a short-lived
+// token that must be exchanged at /auth/2fa/verify
+func (h *AuthHandler) startTwoFactorChallenge(c *gin.Context, user *models.User) {
+	mfaToken, err := generateMFAToken(h.cfg, user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	utils.SuccessResponse(c, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int64(h.cfg.MFATokenTTL.Seconds()),
+	}, "Two-factor authentication required")
+}
+
+// generateMFAToken returns a token proving the user passed the first factor
+func generateMFAToken(cfg *config.Config, user *models.User) (string, error) {
+	return utils.GenerateToken(&utils.Claims{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Purpose: utils.TokenPurposeMFAPending,
+	}, auth.Keys, cfg.MFATokenTTL)
+}
+
+// useSecondFactor accepts either a TOTP code or an unused recovery code
+func useSecondFactor(tx *gorm.DB, user *models.User, code, recoveryCode string) error {
+	if code != "" {
+		if err := useTOTPCode(tx, user, code); err == nil || recoveryCode == "" {
+			return err
+		}
+	}
+	return useRecoveryCode(tx, user.ID, recoveryCode)
+}
+
+// useTOTPCode validates a TOTP code and records its time step so the same
+// code can't be used again
+func useTOTPCode(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return errInvalidTwoFactorCode
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// useRecoveryCode marks a recovery code as used
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and returns new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "3f9a1c2e-7b0d4a86"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(b)
+	return code[:8] + "-" + code[8:], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
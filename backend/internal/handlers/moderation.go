@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ModerationHandler struct {
+	cfg *config.Config
+}
+
+func NewModerationHandler(cfg *config.Config) *ModerationHandler {
+	return &ModerationHandler{cfg: cfg}
+}
+
+type ModerationRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// HidePost hides a post from everyone but its author and moderators
+func (h *ModerationHandler) HidePost(c *gin.Context) {
+	h.setHidden(c, models.ModerationTargetPost, true)
+}
+
+// UnhidePost makes a hidden post visible again
+func (h *ModerationHandler) UnhidePost(c *gin.Context) {
+	h.setHidden(c, models.ModerationTargetPost, false)
+}
+
+// HideComment hides a comment from everyone but its author and moderators
+func (h *ModerationHandler) HideComment(c *gin.Context) {
+	h.setHidden(c, models.ModerationTargetComment, true)
+}
+
+// UnhideComment makes a hidden comment visible again
+func (h *ModerationHandler) UnhideComment(c *gin.Context) {
+	h.setHidden(c, models.ModerationTargetComment, false)
+}
+
+func (h *ModerationHandler) setHidden(c *gin.Context, targetType string, hide bool) {
+	moderatorID, _ := middleware.GetUserID(c)
+
+	var req ModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var model interface{}
+	var target struct {
+		ID       uint
+		UserID   uint
+		HiddenAt *time.Time
+	}
+	if targetType == models.ModerationTargetComment {
+		_, comment, ok := authorizeComment(c, policy.Moderate, c.Param("id"))
+		if !ok {
+			return
+		}
+		model = &models.Comment{}
+		target.ID, target.UserID, target.HiddenAt = comment.ID, comment.UserID, comment.HiddenAt
+	} else {
+		post, ok := authorizePost(c, policy.Moderate, c.Param("id"))
+		if !ok {
+			return
+		}
+		model = &models.Post{}
+		target.ID, target.UserID, target.HiddenAt = post.ID, post.UserID, post.HiddenAt
+	}
+
+	if (target.HiddenAt != nil) == hide {
+		utils.SuccessResponse(c, gin.H{"hidden": hide}, "Nothing to change")
+		return
+	}
+
+	action := models.ModerationActionHide
+	var hiddenAt *time.Time
+	if hide {
+		now := time.Now()
+		hiddenAt = &now
+	} else {
+		action = models.ModerationActionUnhide
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Where("id = ?", target.ID).Update("hidden_at", hiddenAt).Error; err != nil {
+			return err
+		}
+		return recordModerationAction(tx, moderatorID, action, targetType, target.ID, target.UserID, req.Reason)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update content")
+		return
+	}
+
+	message := "Content hidden"
+	if !hide {
+		message = "Content unhidden"
+	}
+	utils.SuccessResponse(c, gin.H{"hidden": hide}, message)
+}
+
+// GetActions lists moderation actions, newest first. Filter with the
+// moderator_id, target_type and target_id query parameters.
+func (h *ModerationHandler) GetActions(c *gin.Context) {
+	page, ok := utils.ParsePage(c, 50)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Model(&models.ModerationAction{})
+	if moderatorID := c.Query("moderator_id"); moderatorID != "" {
+		query = query.Where("moderator_id = ?", moderatorID)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var actions []models.ModerationAction
+	if err := page.Apply(query, "moderation_actions", false).Find(&actions).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch moderation actions")
+		return
+	}
+	actions, next := utils.NextPage(actions, page, func(a *models.ModerationAction) (time.Time, uint) {
+		return a.CreatedAt, a.ID
+	})
+
+	utils.PaginatedSuccessResponse(c, actions, page.Limit, next)
+}
+
+func recordModerationAction(tx *gorm.DB, moderatorID uint, action, targetType string, targetID, ownerID uint, reason string) error {
+	return tx.Create(&models.ModerationAction{
+		ModeratorID: moderatorID,
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		TargetOwner: ownerID,
+		Reason:      truncate(reason, 500),
+	}).Error
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/oauth"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// oauthStateTTL is how long the user has to finish signing in at the provider
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	errEmailRequired    = errors.New("provider did not return a verified email")
+	errAccountNotLinked = errors.New("existing account is not verified")
+)
+
+type OAuthHandler struct {
+	cfg       *config.Config
+	providers oauth.Registry
+}
+
+func NewOAuthHandler(cfg *config.Config, providers oauth.Registry) *OAuthHandler {
+	return &OAuthHandler{cfg: cfg, providers: providers}
+}
+
+// ListProviders returns the names of the configured social login providers
+func (h *OAuthHandler) ListProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	utils.SuccessResponse(c, names, "Providers retrieved successfully")
+}
+
+// Start redirects the browser to the provider's sign in page. The state, PKCE
+// verifier and ID token nonce are kept in a short-lived cookie bound to this
+// browser.
+func (h *OAuthHandler) Start(c *gin.Context) {
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Unknown login provider")
+		return
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start login")
+		return
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start login")
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, verifier, nonce)
+	if err != nil {
+		log.Printf("OAuth %s: %v", provider.Name(), err)
+		utils.ErrorResponse(c, http.StatusBadGateway, "provider_error", "Login provider is unavailable")
+		return
+	}
+
+	h.setStateCookie(c, provider.Name(), strings.Join([]string{state, verifier, nonce}, "."), int(oauthStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes the sign in, links or creates the user and hands the
+// tokens to the frontend in the URL fragment
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	provider, err := h.providers.Get(c.Param("provider"))
+	if err != nil {
+		h.redirectError(c, "unknown_provider")
+		return
+	}
+
+	cookie, _ := c.Cookie(stateCookieName(provider.Name()))
+	h.setStateCookie(c, provider.Name(), "", -1)
+
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.Query("state"))) != 1 {
+		h.redirectError(c, "invalid_state")
+		return
+	}
+
+	if c.Query("error") != "" || c.Query("code") == "" {
+		h.redirectError(c, "access_denied")
+		return
+	}
+
+	verifier, nonce := parts[1], parts[2]
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("OAuth %s: %v", provider.Name(), err)
+		h.redirectError(c, "provider_error")
+		return
+	}
+
+	user, err := findOrCreateOAuthUser(provider.Name(), identity)
+	switch {
+	case errors.Is(err, errEmailRequired):
+		h.redirectError(c, "email_not_verified")
+		return
+	case errors.Is(err, errAccountNotLinked):
+		h.redirectError(c, "account_exists")
+		return
+	case errors.Is(err, errAccountDeleted):
+		h.redirectError(c, "account_deleted")
+		return
+	case err != nil:
+		log.Printf("OAuth %s: %v", provider.Name(), err)
+		h.redirectError(c, "server_error")
+		return
+	}
+
+	fragment := url.Values{}
+	if user.HasTwoFactor() {
+		mfaToken, err := generateMFAToken(h.cfg, user)
+		if err != nil {
+			h.redirectError(c, "server_error")
+			return
+		}
+		fragment.Set("mfa_token", mfaToken)
+	} else {
+		resp, err := issueSession(c, h.cfg, user)
+		if err != nil {
+			h.redirectError(c, "server_error")
+			return
+		}
+		fragment.Set("token", resp.Token)
+		fragment.Set("refresh_token", resp.RefreshToken)
+		fragment.Set("expires_in", fmt.Sprintf("%d", resp.ExpiresIn))
+	}
+
+	c.Redirect(http.StatusFound, h.cfg.AppURL+"/oauth/callback#"+fragment.Encode())
+}
+
+// ListIdentities returns the external accounts linked to the current user
+func (h *OAuthHandler) ListIdentities(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch linked accounts")
+		return
+	}
+
+	responses := make([]models.UserIdentityResponse, len(identities))
+	for i, identity := range identities {
+		responses[i] = identity.ToResponse()
+	}
+
+	utils.SuccessResponse(c, responses, fmt.Sprintf("%d linked accounts found", len(responses)))
+}
+
+// DeleteIdentity unlinks an external account, as long as the user keeps
+// another way to sign in
+func (h *OAuthHandler) DeleteIdentity(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var identity models.UserIdentity
+	if err := database.DB.Preload("User").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&identity).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Linked account not found")
+		return
+	}
+
+	if loginMethodCount(&identity.User) <= 1 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "last_login_method", "Set a password before unlinking your only login method")
+		return
+	}
+
+	if err := database.DB.Delete(&identity).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to unlink account")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Account unlinked successfully")
+}
+
+// findOrCreateOAuthUser returns the user linked to the identity. Unknown
+// identities are linked to the account with the same verified email, or a
+// new account is created.
+func findOrCreateOAuthUser(provider string, identity *oauth.Identity) (*models.User, error) {
+	var linked models.UserIdentity
+	err := database.DB.Preload("User").
+		Where("provider = ? AND subject = ?", provider, identity.Subject).
+		First(&linked).Error
+	if err == nil {
+		// Deleted users aren't preloaded
+		if linked.User.ID == 0 {
+			return nil, errAccountDeleted
+		}
+		return &linked.User, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Only trust addresses the provider has verified
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errEmailRequired
+	}
+
+	var user models.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("email = ?", identity.Email).First(&user).Error
+		switch {
+		case err == nil:
+			// Someone may have registered this address without owning it
+			if !user.IsEmailVerified() {
+				return errAccountNotLinked
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// A deleted account keeps its address until it is purged
+			var deleted int64
+			tx.Unscoped().Model(&models.User{}).Where("email = ?", identity.Email).Count(&deleted)
+			if deleted > 0 {
+				return errAccountDeleted
+			}
+
+			now := time.Now()
+			user = models.User{
+				FirstName:       identity.FirstName,
+				LastName:        identity.LastName,
+				Email:           identity.Email,
+				EmailVerifiedAt: &now,
+				Role:            models.RoleUser,
+			}
+			localPart, _, _ := strings.Cut(identity.Email, "@")
+			if user.FirstName == "" {
+				user.FirstName = localPart
+			}
+			if user.Handle, err = newHandle(tx, localPart); err != nil {
+				return err
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setStateCookie stores or clears the login state for a provider
+func (h *OAuthHandler) setStateCookie(c *gin.Context, provider, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.cfg.PublicURL, "https://")
+	c.SetCookie(stateCookieName(provider), value, maxAge, "/api/auth/oauth", "", secure, true)
+}
+
+// redirectError sends the browser back to the frontend login page
+func (h *OAuthHandler) redirectError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, h.cfg.AppURL+"/login?error="+url.QueryEscape(code))
+}
+
+func stateCookieName(provider string) string {
+	return "oauth_state_" + provider
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/oauth"
+	"github.com/applifylab/social-feed-backend/internal/oauthtest"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+)
+
+// oauthFlow runs the social login routes against a fake issuer registered
+// as the "test" provider
+type oauthFlow struct {
+	iss    *oauthtest.Issuer
+	router *gin.Engine
+}
+
+func newOAuthFlow(t *testing.T) *oauthFlow {
+	t.Helper()
+
+	cfg := testConfig(t)
+	iss := oauthtest.NewIssuer(t, "client")
+	provider := oauth.NewOIDCProvider("test", iss.URL, "client", "secret",
+		cfg.PublicURL+"/api/auth/oauth/test/callback")
+	h := NewOAuthHandler(cfg, oauth.Registry{"test": provider})
+
+	router := gin.New()
+	router.GET("/api/auth/oauth/:provider", h.Start)
+	router.GET("/api/auth/oauth/:provider/callback", h.Callback)
+	return &oauthFlow{iss: iss, router: router}
+}
+
+// start begins a login, signs in at the issuer and returns the URL the
+// issuer sends the browser back to along with the state cookie
+func (f *oauthFlow) start(t *testing.T) (*url.URL, *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oauth/test", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Start status = %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Start set %d cookies, want 1", len(cookies))
+	}
+	return f.iss.Authorize(t, w.Header().Get("Location")), cookies[0]
+}
+
+// callback finishes a login and returns where the browser ends up
+func (f *oauthFlow) callback(t *testing.T, callback *url.URL, cookie *http.Cookie) *url.URL {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Callback status = %d: %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// login runs the whole flow as user
+func (f *oauthFlow) login(t *testing.T, user oauthtest.User) *url.URL {
+	t.Helper()
+
+	f.iss.User = user
+	callback, cookie := f.start(t)
+	return f.callback(t, callback, cookie)
+}
+
+// loginError returns the error the frontend is sent, or "" on success
+func loginError(t *testing.T, location *url.URL) string {
+	t.Helper()
+
+	if location.Path == "/login" {
+		return location.Query().Get("error")
+	}
+	if location.Path != "/oauth/callback" {
+		t.Fatalf("redirected to %s", location)
+	}
+	return ""
+}
+
+// linkedUser returns the user the subject is linked to, 0 if none
+func linkedUser(t *testing.T, subject string) uint {
+	t.Helper()
+
+	var userIDs []uint
+	database.DB.Model(&models.UserIdentity{}).
+		Where("provider = ? AND subject = ?", "test", subject).
+		Pluck("user_id", &userIDs)
+	if len(userIDs) == 0 {
+		return 0
+	}
+	return userIDs[0]
+}
+
+func TestOAuthLoginCreatesAccount(t *testing.T) {
+	testdb.Open(t)
+	f := newOAuthFlow(t)
+	identity := oauthtest.User{Subject: "sub-1", Email: "Jane@Example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"}
+
+	location := f.login(t, identity)
+	if code := loginError(t, location); code != "" {
+		t.Fatalf("login failed: %s", code)
+	}
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if fragment.Get("token") == "" || fragment.Get("refresh_token") == "" {
+		t.Errorf("fragment = %q, want tokens", location.Fragment)
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", "jane@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.FirstName != "Jane" || user.LastName != "Doe" || !user.IsEmailVerified() {
+		t.Errorf("user = %+v", user)
+	}
+	if got := linkedUser(t, "sub-1"); got != user.ID {
+		t.Errorf("identity linked to %d, want %d", got, user.ID)
+	}
+
+	// Signing in again uses the linked account
+	if code := loginError(t, f.login(t, identity)); code != "" {
+		t.Fatalf("second login failed: %s", code)
+	}
+	var count int64
+	database.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d users, want 1", count)
+	}
+}
+
+func TestOAuthLoginLinksVerifiedEmail(t *testing.T) {
+	testdb.Open(t)
+	f := newOAuthFlow(t)
+	alice := createUser(t, "alice")
+
+	location := f.login(t, oauthtest.User{Subject: "sub-1", Email: "ALICE@example.com", EmailVerified: true})
+	if code := loginError(t, location); code != "" {
+		t.Fatalf("login failed: %s", code)
+	}
+	if got := linkedUser(t, "sub-1"); got != alice.ID {
+		t.Errorf("identity linked to %d, want alice (%d)", got, alice.ID)
+	}
+}
+
+func TestOAuthLoginRefusesUnverifiedEmail(t *testing.T) {
+	testdb.Open(t)
+	f := newOAuthFlow(t)
+
+	// Someone registered bob's address without confirming it
+	squatter := createUser(t, "bob")
+	database.DB.Model(squatter).Update("email_verified_at", nil)
+
+	tests := []struct {
+		name     string
+		identity oauthtest.User
+		want     string
+	}{
+		// errEmailRequired
+		{"provider did not verify", oauthtest.User{Subject: "sub-1", Email: "carol@example.com"}, "email_not_verified"},
+		{"provider sent no email", oauthtest.User{Subject: "sub-2", EmailVerified: true}, "email_not_verified"},
+		// errAccountNotLinked
+		{"account not verified", oauthtest.User{Subject: "sub-3", Email: "bob@example.com", EmailVerified: true}, "account_exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := loginError(t, f.login(t, tt.identity)); code != tt.want {
+				t.Errorf("error = %q, want %q", code, tt.want)
+			}
+			if got := linkedUser(t, tt.identity.Subject); got != 0 {
+				t.Errorf("identity linked to %d", got)
+			}
+		})
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d users, want only the existing one", count)
+	}
+}
+
+func TestOAuthLoginTwoFactor(t *testing.T) {
+	testdb.Open(t)
+	f := newOAuthFlow(t)
+	alice := createUser(t, "alice")
+	database.DB.Model(alice).Update("totp_enabled_at", time.Now())
+
+	location := f.login(t, oauthtest.User{Subject: "sub-1", Email: "alice@example.com", EmailVerified: true})
+	if code := loginError(t, location); code != "" {
+		t.Fatalf("login failed: %s", code)
+	}
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if fragment.Get("mfa_token") == "" || fragment.Get("token") != "" || fragment.Get("refresh_token") != "" {
+		t.Errorf("fragment = %q, want only an mfa_token", location.Fragment)
+	}
+}
+
+func TestOAuthCallbackRejectsForeignLogin(t *testing.T) {
+	testdb.Open(t)
+	f := newOAuthFlow(t)
+	f.iss.User = oauthtest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true}
+
+	// withCookie replaces part i of the state cookie (state, verifier, nonce)
+	withCookie := func(cookie *http.Cookie, i int, value string) *http.Cookie {
+		parts := strings.Split(cookie.Value, ".")
+		parts[i] = value
+		return &http.Cookie{Name: cookie.Name, Value: strings.Join(parts, ".")}
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(callback *url.URL, cookie *http.Cookie) (*url.URL, *http.Cookie)
+		want   string
+	}{
+		{"no cookie", func(cb *url.URL, _ *http.Cookie) (*url.URL, *http.Cookie) {
+			return cb, nil
+		}, "invalid_state"},
+		{"state mismatch", func(cb *url.URL, cookie *http.Cookie) (*url.URL, *http.Cookie) {
+			q := cb.Query()
+			q.Set("state", "forged")
+			cb.RawQuery = q.Encode()
+			return cb, cookie
+		}, "invalid_state"},
+		{"PKCE mismatch", func(cb *url.URL, cookie *http.Cookie) (*url.URL, *http.Cookie) {
+			return cb, withCookie(cookie, 1, "wrong-verifier-wrong-verifier-wrong-verifier")
+		}, "provider_error"},
+		{"nonce mismatch", func(cb *url.URL, cookie *http.Cookie) (*url.URL, *http.Cookie) {
+			return cb, withCookie(cookie, 2, "other-nonce")
+		}, "provider_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callback, cookie := f.start(t)
+			callback, cookie = tt.tamper(callback, cookie)
+			if code := loginError(t, f.callback(t, callback, cookie)); code != tt.want {
+				t.Errorf("error = %q, want %q", code, tt.want)
+			}
+			if got := linkedUser(t, "sub-1"); got != 0 {
+				t.Errorf("identity linked to %d", got)
+			}
+		})
+	}
+
+	// The callback can't be replayed once the code has been redeemed
+	callback, cookie := f.start(t)
+	if code := loginError(t, f.callback(t, callback, cookie)); code != "" {
+		t.Fatalf("login failed: %s", code)
+	}
+	if code := loginError(t, f.callback(t, callback, cookie)); code != "provider_error" {
+		t.Errorf("replayed callback error = %q, want provider_error", code)
+	}
+}
+
+func TestListIdentities(t *testing.T) {
+	testdb.Open(t)
+	h := NewOAuthHandler(testConfig(t), oauth.Registry{})
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	for _, identity := range []models.UserIdentity{
+		{UserID: alice.ID, Provider: "google", Subject: "g-1", Email: "alice@example.com"},
+		{UserID: bob.ID, Provider: "google", Subject: "g-2", Email: "bob@example.com"},
+	} {
+		if err := database.DB.Create(&identity).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var items []map[string]interface{}
+	decode(t, serve(t, h.ListIdentities, http.MethodGet, "/", nil, alice.ID), &items)
+	if len(items) != 1 {
+		t.Fatalf("got %d identities, want 1", len(items))
+	}
+	for _, key := range []string{"id", "provider", "email", "created_at"} {
+		if _, ok := items[0][key]; !ok {
+			t.Errorf("identity has no %q", key)
+		}
+	}
+	for _, key := range []string{"user", "user_id", "subject"} {
+		if _, ok := items[0][key]; ok {
+			t.Errorf("identity exposes %q", key)
+		}
+	}
+	if items[0]["email"] != "alice@example.com" {
+		t.Errorf("email = %v", items[0]["email"])
+	}
+}
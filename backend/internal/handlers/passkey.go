@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+// passkeyChallengeTTL is how long the browser has to answer a WebAuthn challenge
+const passkeyChallengeTTL = 5 * time.Minute
+
+// webAuthnHandleBytes is the size of the random user handle stored on passkeys
+const webAuthnHandleBytes = 32
+
+var errInvalidPasskeyChallenge = errors.New("invalid or expired passkey challenge")
+
+type PasskeyHandler struct {
+	cfg      *config.Config
+	webauthn *webauthn.WebAuthn
+}
+
+func NewPasskeyHandler(cfg *config.Config, w *webauthn.WebAuthn) *PasskeyHandler {
+	return &PasskeyHandler{cfg: cfg, webauthn: w}
+}
+
+type PasskeyOptionsResponse struct {
+	ChallengeID string      `json:"challenge_id"`
+	Options     interface{} `json:"options"`
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Name        string          `json:"name" binding:"max=100"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+type FinishPasskeyLoginRequest struct {
+	ChallengeID string          `json:"challenge_id" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+// BeginRegistration returns the options to pass to navigator.credentials.create()
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, err := loadPasskeyUser(userID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+
+	if len(user.User.WebAuthnHandle) == 0 {
+		handle := make([]byte, webAuthnHandleBytes)
+		if _, err := rand.Read(handle); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start passkey registration")
+			return
+		}
+		if err := database.DB.Model(user.User).Update("webauthn_handle", handle).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start passkey registration")
+			return
+		}
+		user.User.WebAuthnHandle = handle
+	}
+
+	creation, session, err := h.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start passkey registration")
+		return
+	}
+
+	challengeID, err := savePasskeyChallenge(models.PasskeyCeremonyRegistration, &userID, session)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start passkey registration")
+		return
+	}
+
+	utils.SuccessResponse(c, PasskeyOptionsResponse{ChallengeID: challengeID, Options: creation}, "Passkey registration started")
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new passkey
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req FinishPasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	session, err := consumePasskeyChallenge(req.ChallengeID, models.PasskeyCeremonyRegistration, &userID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_challenge", "Passkey registration expired, please try again")
+		return
+	}
+
+	user, err := loadPasskeyUser(userID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_credential", "Invalid passkey response")
+		return
+	}
+
+	credential, err := h.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_credential", "Passkey could not be verified")
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey := auth.NewPasskey(userID, name, credential)
+	if err := database.DB.Create(&passkey).Error; err != nil {
+		if database.IsUniqueViolation(err) {
+			utils.ErrorResponse(c, http.StatusConflict, "passkey_exists", "This passkey is already registered")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to save passkey")
+		return
+	}
+
+	utils.SuccessResponse(c, passkey, "Passkey registered successfully")
+}
+
+// BeginLogin returns the options to pass to navigator.credentials.get(). The
+// browser offers every passkey it holds for this site, so no email is needed.
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	assertion, session, err := h.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start passkey login")
+		return
+	}
+
+	challengeID, err := savePasskeyChallenge(models.PasskeyCeremonyLogin, nil, session)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to start passkey login")
+		return
+	}
+
+	utils.SuccessResponse(c, PasskeyOptionsResponse{ChallengeID: challengeID, Options: assertion}, "Passkey login started")
+}
+
+// FinishLogin verifies the signed challenge and issues tokens. Passkeys
+// require user verification, so no second factor is asked for.
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var req FinishPasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	session, err := consumePasskeyChallenge(req.ChallengeID, models.PasskeyCeremonyLogin, nil)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_challenge", "Passkey login expired, please try again")
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_credential", "Invalid passkey response")
+		return
+	}
+
+	// The browser tells us whose passkey it used through the user handle
+	var user *auth.PasskeyUser
+	findUser := func(_, userHandle []byte) (webauthn.User, error) {
+		var userID uint
+		if err := database.DB.Model(&models.User{}).
+			Where("webauthn_handle = ?", userHandle).
+			Pluck("id", &userID).Error; err != nil || userID == 0 {
+			return nil, errors.New("unknown user handle")
+		}
+
+		found, err := loadPasskeyUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		user = found
+		return found, nil
+	}
+
+	_, credential, err := h.webauthn.ValidatePasskeyLogin(findUser, *session, parsed)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Passkey could not be verified")
+		return
+	}
+
+	var passkey *models.Passkey
+	for i := range user.Passkeys {
+		if bytes.Equal(user.Passkeys[i].CredentialID, credential.ID) {
+			passkey = &user.Passkeys[i]
+			break
+		}
+	}
+	if passkey == nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Passkey could not be verified")
+		return
+	}
+
+	// A signature counter that didn't increase means the private key may
+	// have been copied to another authenticator
+	if credential.Authenticator.CloneWarning {
+		database.DB.Model(passkey).Update("clone_warning", true)
+		utils.ErrorResponse(c, http.StatusUnauthorized, "passkey_cloned", "This passkey can no longer be used, please sign in another way")
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(passkey).Updates(map[string]interface{}{
+		"sign_count":   int64(credential.Authenticator.SignCount),
+		"backup_state": credential.Flags.BackupState,
+		"last_used_at": now,
+	}).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update passkey")
+		return
+	}
+
+	resp, err := issueSession(c, h.cfg, user.User)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	utils.SuccessResponse(c, resp, "Login successful")
+}
+
+// ListPasskeys returns the passkeys registered by the current user
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var passkeys []models.Passkey
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&passkeys).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch passkeys")
+		return
+	}
+
+	utils.SuccessResponse(c, passkeys, fmt.Sprintf("%d passkeys found", len(passkeys)))
+}
+
+// DeletePasskey removes a passkey, as long as the user keeps another way to
+// sign in
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var passkey models.Passkey
+	if err := database.DB.Preload("User").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&passkey).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Passkey not found")
+		return
+	}
+
+	if loginMethodCount(&passkey.User) <= 1 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "last_login_method", "Set a password before removing your only login method")
+		return
+	}
+
+	if err := database.DB.Delete(&passkey).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to delete passkey")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Passkey deleted successfully")
+}
+
+// loadPasskeyUser loads a user together with their passkeys
+func loadPasskeyUser(userID uint) (*auth.PasskeyUser, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var passkeys []models.Passkey
+	if err := database.DB.Where("user_id = ?", userID).Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+
+	return &auth.PasskeyUser{User: &user, Passkeys: passkeys}, nil
+}
+
+// loginMethodCount returns how many ways the user has to sign in: their
+// password, linked social accounts and passkeys
+func loginMethodCount(user *models.User) int64 {
+	var identities, passkeys int64
+	database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&identities)
+	database.DB.Model(&models.Passkey{}).Where("user_id = ?", user.ID).Count(&passkeys)
+
+	count := identities + passkeys
+	if user.PasswordHash != "" {
+		count++
+	}
+	return count
+}
+
+// savePasskeyChallenge stores the ceremony state and returns the ID the
+// client must send back with the authenticator's response
+func savePasskeyChallenge(ceremony string, userID *uint, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	challengeID, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	// Drop ceremonies that were never finished
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.PasskeyChallenge{})
+
+	challenge := models.PasskeyChallenge{
+		TokenHash: utils.HashToken(challengeID),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(passkeyChallengeTTL),
+	}
+	if err := database.DB.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return challengeID, nil
+}
+
+// consumePasskeyChallenge loads and deletes the ceremony state, so every
+// challenge can only be answered once
+func consumePasskeyChallenge(challengeID, ceremony string, userID *uint) (*webauthn.SessionData, error) {
+	var challenge models.PasskeyChallenge
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ? AND ceremony = ?", utils.HashToken(challengeID), ceremony).
+			First(&challenge).Error; err != nil {
+			return errInvalidPasskeyChallenge
+		}
+
+		result := tx.Delete(&challenge)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidPasskeyChallenge
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, errInvalidPasskeyChallenge
+	}
+	if (userID == nil) != (challenge.UserID == nil) || (userID != nil && *userID != *challenge.UserID) {
+		return nil, errInvalidPasskeyChallenge
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(challenge.Data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator is a virtual authenticator holding a single P-256
+// passkey. It answers the options the server hands out the way a browser
+// and platform authenticator would.
+type softAuthenticator struct {
+	rpID         string
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{rpID: rpID, origin: origin, key: key, credentialID: credentialID}
+}
+
+// create answers navigator.credentials.create() with a "none" attestation
+func (a *softAuthenticator) create(t *testing.T, options protocol.PublicKeyCredentialCreationOptions, userID string) []byte {
+	t.Helper()
+
+	handle, err := base64.RawURLEncoding.DecodeString(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = handle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authData := a.authData(flagUserPresent | flagUserVerified | flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", options.Challenge),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() by signing the challenge
+func (a *softAuthenticator) get(t *testing.T, options protocol.PublicKeyCredentialRequestOptions) []byte {
+	t.Helper()
+
+	clientData := a.clientData(t, "webauthn.get", options.Challenge)
+	authData := a.authData(flagUserPresent | flagUserVerified)
+
+	raw, err := base64.RawURLEncoding.DecodeString(clientData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDataHash := sha256.Sum256(raw)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    clientData,
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": encode(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encode(data)
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type creationOptions struct {
+	ChallengeID string `json:"challenge_id"`
+	Options     struct {
+		PublicKey struct {
+			protocol.PublicKeyCredentialCreationOptions
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+type requestOptions struct {
+	ChallengeID string                       `json:"challenge_id"`
+	Options     protocol.CredentialAssertion `json:"options"`
+}
+
+func newPasskeyHandler(t *testing.T) *PasskeyHandler {
+	t.Helper()
+
+	cfg := testConfig(t)
+	w, err := auth.NewWebAuthn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPasskeyHandler(cfg, w)
+}
+
+// registerPasskey runs the registration ceremony for the user with a new
+// software authenticator
+func registerPasskey(t *testing.T, h *PasskeyHandler, user *models.User) *softAuthenticator {
+	t.Helper()
+
+	var begin creationOptions
+	decode(t, serve(t, h.BeginRegistration, http.MethodPost, "/", nil, user.ID), &begin)
+
+	authenticator := newSoftAuthenticator(t, h.cfg.WebAuthnRPID, h.cfg.AppURL)
+	credential := authenticator.create(t, begin.Options.PublicKey.PublicKeyCredentialCreationOptions, begin.Options.PublicKey.User.ID)
+
+	w := serve(t, h.FinishRegistration, http.MethodPost, "/", FinishPasskeyRegistrationRequest{
+		ChallengeID: begin.ChallengeID,
+		Name:        "Laptop",
+		Credential:  credential,
+	}, user.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("FinishRegistration status = %d: %s", w.Code, w.Body)
+	}
+	return authenticator
+}
+
+// beginLogin starts a login ceremony and returns its challenge
+func beginLogin(t *testing.T, h *PasskeyHandler) requestOptions {
+	t.Helper()
+
+	var begin requestOptions
+	decode(t, serve(t, h.BeginLogin, http.MethodPost, "/", nil, 0), &begin)
+	return begin
+}
+
+func finishLogin(t *testing.T, h *PasskeyHandler, challengeID string, credential []byte) int {
+	t.Helper()
+
+	w := serve(t, h.FinishLogin, http.MethodPost, "/", FinishPasskeyLoginRequest{
+		ChallengeID: challengeID,
+		Credential:  credential,
+	}, 0)
+	return w.Code
+}
+
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	testdb.Open(t)
+	h := newPasskeyHandler(t)
+	user := createUser(t, "alice")
+
+	authenticator := registerPasskey(t, h, user)
+
+	var passkey models.Passkey
+	if err := database.DB.Where("user_id = ?", user.ID).First(&passkey).Error; err != nil {
+		t.Fatal("passkey wasn't stored:", err)
+	}
+	if passkey.Name != "Laptop" {
+		t.Errorf("name = %q, want Laptop", passkey.Name)
+	}
+
+	authenticator.signCount = 1
+	begin := beginLogin(t, h)
+	w := serve(t, h.FinishLogin, http.MethodPost, "/", FinishPasskeyLoginRequest{
+		ChallengeID: begin.ChallengeID,
+		Credential:  authenticator.get(t, begin.Options.Response),
+	}, 0)
+
+	var resp AuthResponse
+	decode(t, w, &resp)
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Error("login didn't issue tokens")
+	}
+	if resp.User.ID != user.ID {
+		t.Errorf("logged in as user %d, want %d", resp.User.ID, user.ID)
+	}
+
+	database.DB.First(&passkey, passkey.ID)
+	if passkey.SignCount != 1 {
+		t.Errorf("sign count = %d, want 1", passkey.SignCount)
+	}
+	if passkey.LastUsedAt == nil {
+		t.Error("last used time wasn't recorded")
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	testdb.Open(t)
+	h := newPasskeyHandler(t)
+	user := createUser(t, "alice")
+	authenticator := registerPasskey(t, h, user)
+
+	authenticator.signCount = 5
+	begin := beginLogin(t, h)
+	if code := finishLogin(t, h, begin.ChallengeID, authenticator.get(t, begin.Options.Response)); code != http.StatusOK {
+		t.Fatalf("first login status = %d, want 200", code)
+	}
+
+	// A copy of the key that has signed fewer times than the original
+	authenticator.signCount = 3
+	begin = beginLogin(t, h)
+	w := serve(t, h.FinishLogin, http.MethodPost, "/", FinishPasskeyLoginRequest{
+		ChallengeID: begin.ChallengeID,
+		Credential:  authenticator.get(t, begin.Options.Response),
+	}, 0)
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != "passkey_cloned" {
+		t.Fatalf("status = %d %s, want 401 passkey_cloned", w.Code, w.Body)
+	}
+
+	var passkey models.Passkey
+	database.DB.Where("user_id = ?", user.ID).First(&passkey)
+	if !passkey.CloneWarning {
+		t.Error("clone warning wasn't stored")
+	}
+	if passkey.SignCount != 5 {
+		t.Errorf("sign count = %d, want 5", passkey.SignCount)
+	}
+
+	// The flagged passkey stays unusable, even with a higher count
+	authenticator.signCount = 10
+	begin = beginLogin(t, h)
+	if code := finishLogin(t, h, begin.ChallengeID, authenticator.get(t, begin.Options.Response)); code != http.StatusUnauthorized {
+		t.Errorf("login with flagged passkey status = %d, want 401", code)
+	}
+}
+
+func TestPasskeyLoginChallengeCannotBeReused(t *testing.T) {
+	testdb.Open(t)
+	h := newPasskeyHandler(t)
+	user := createUser(t, "alice")
+	authenticator := registerPasskey(t, h, user)
+
+	authenticator.signCount = 1
+	begin := beginLogin(t, h)
+	credential := authenticator.get(t, begin.Options.Response)
+	if code := finishLogin(t, h, begin.ChallengeID, credential); code != http.StatusOK {
+		t.Fatalf("first login status = %d, want 200", code)
+	}
+
+	// Replaying the same signed response, and a fresh one for the same
+	// challenge, both fail
+	if code := finishLogin(t, h, begin.ChallengeID, credential); code != http.StatusUnauthorized {
+		t.Errorf("replayed login status = %d, want 401", code)
+	}
+	authenticator.signCount = 2
+	if code := finishLogin(t, h, begin.ChallengeID, authenticator.get(t, begin.Options.Response)); code != http.StatusUnauthorized {
+		t.Errorf("reused challenge status = %d, want 401", code)
+	}
+}
+
+func TestPasskeyRegistrationChallengeCannotBeReused(t *testing.T) {
+	testdb.Open(t)
+	h := newPasskeyHandler(t)
+	user := createUser(t, "alice")
+
+	var begin creationOptions
+	decode(t, serve(t, h.BeginRegistration, http.MethodPost, "/", nil, user.ID), &begin)
+	options := begin.Options.PublicKey.PublicKeyCredentialCreationOptions
+
+	first := newSoftAuthenticator(t, h.cfg.WebAuthnRPID, h.cfg.AppURL)
+	w := serve(t, h.FinishRegistration, http.MethodPost, "/", FinishPasskeyRegistrationRequest{
+		ChallengeID: begin.ChallengeID,
+		Credential:  first.create(t, options, begin.Options.PublicKey.User.ID),
+	}, user.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first registration status = %d: %s", w.Code, w.Body)
+	}
+
+	second := newSoftAuthenticator(t, h.cfg.WebAuthnRPID, h.cfg.AppURL)
+	w = serve(t, h.FinishRegistration, http.MethodPost, "/", FinishPasskeyRegistrationRequest{
+		ChallengeID: begin.ChallengeID,
+		Credential:  second.create(t, options, begin.Options.PublicKey.User.ID),
+	}, user.ID)
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != "invalid_challenge" {
+		t.Errorf("status = %d %s, want 400 invalid_challenge", w.Code, w.Body)
+	}
+
+	var count int64
+	database.DB.Model(&models.Passkey{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("%d passkeys stored, want 1", count)
+	}
+}
+
+func TestPasskeyRegistrationChallengeIsBoundToUser(t *testing.T) {
+	testdb.Open(t)
+	h := newPasskeyHandler(t)
+	alice := createUser(t, "alice")
+	mallory := createUser(t, "mallory")
+
+	var begin creationOptions
+	decode(t, serve(t, h.BeginRegistration, http.MethodPost, "/", nil, alice.ID), &begin)
+
+	authenticator := newSoftAuthenticator(t, h.cfg.WebAuthnRPID, h.cfg.AppURL)
+	w := serve(t, h.FinishRegistration, http.MethodPost, "/", FinishPasskeyRegistrationRequest{
+		ChallengeID: begin.ChallengeID,
+		Credential:  authenticator.create(t, begin.Options.PublicKey.PublicKeyCredentialCreationOptions, begin.Options.PublicKey.User.ID),
+	}, mallory.ID)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
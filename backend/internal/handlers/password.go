@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email belongs to an account.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	const message = "If an account exists for this email, a password reset link has been sent"
+
+	var user models.User
+	if err := database.DB.Where("email = ?", strings.ToLower(req.Email)).First(&user).Error; err != nil {
+		utils.SuccessResponse(c, nil, message)
+		return
+	}
+
+	token, err := createUserToken(database.DB, user.ID, models.TokenPurposePasswordReset, h.cfg.PasswordResetTTL)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create reset token")
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.cfg.AppURL, url.QueryEscape(token))
+	h.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.FirstName, h.cfg.PasswordResetTTL, link),
+	})
+
+	utils.SuccessResponse(c, nil, message)
+}
+
+// ResetPassword sets a new password using a reset token and logs the user
+// out everywhere
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to process password")
+		return
+	}
+
+	var userID uint
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", token.UserID).
+			Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
+
+		if err := auth.BumpTokenVersion(tx, token.UserID); err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, token.UserID)
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_token", "Invalid or expired reset token")
+		return
+	}
+	if errors.Is(err, errAccountDeleted) {
+		accountDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to reset password")
+		return
+	}
+	auth.ForgetTokenVersion(userID)
+
+	utils.SuccessResponse(c, nil, "Password reset successfully")
+}
+
+// sendEmail delivers an email in the background so slow mail servers don't
+// hold up the request
+func (h *AuthHandler) sendEmail(msg mailer.Message) {
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Printf("Failed to send email to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+// ChangePassword changes the current user's password. Every session is
+// revoked and a fresh one is started for the caller.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if !utils.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "invalid_credentials", "Current password is incorrect")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to process password")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
+		if err := auth.BumpTokenVersion(tx, user.ID); err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to change password")
+		return
+	}
+	auth.ForgetTokenVersion(user.ID)
+
+	// Reload to pick up the new token version
+	database.DB.First(&user, user.ID)
+	resp, err := issueSession(c, h.cfg, &user)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	utils.SuccessResponse(c, resp, "Password changed successfully")
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// viewer is the current user as the policy sees them
+func viewer(c *gin.Context) policy.Viewer {
+	userID, _ := middleware.GetUserID(c)
+	return policy.Viewer{ID: userID, Role: middleware.GetRole(c)}
+}
+
+// authorizePost loads a post and checks that the current user may perform
+// action on it, responding if there is no such post or they may not
+func authorizePost(c *gin.Context, action policy.Action, postID interface{}) (*models.Post, bool) {
+	var post models.Post
+	if err := database.DB.First(&post, postID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Post not found")
+		return nil, false
+	}
+	if err := policy.AuthorizePost(viewer(c), action, &post); err != nil {
+		denied(c, err)
+		return nil, false
+	}
+	return &post, true
+}
+
+// authorizeComment loads a comment and its post and checks that the current
+// user may perform action on the comment, responding if there is no such
+// comment or they may not
+func authorizeComment(c *gin.Context, action policy.Action, commentID interface{}) (*models.Post, *models.Comment, bool) {
+	var comment models.Comment
+	if err := database.DB.First(&comment, commentID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Comment not found")
+		return nil, nil, false
+	}
+
+	// The policy decides what a deleted post means for its comments
+	var post models.Post
+	if err := database.DB.Unscoped().First(&post, comment.PostID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Comment not found")
+		return nil, nil, false
+	}
+
+	if err := policy.AuthorizeComment(viewer(c), action, &post, &comment); err != nil {
+		denied(c, err)
+		return nil, nil, false
+	}
+	return &post, &comment, true
+}
+
+// denied responds to an action the policy refused
+func denied(c *gin.Context, err error) {
+	var denial *policy.Denial
+	if errors.As(err, &denial) {
+		utils.ErrorResponse(c, denial.Status, denial.Code, denial.Message)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to check permissions")
+}
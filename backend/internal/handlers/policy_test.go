@@ -0,0 +1,532 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+)
+
+// policyFixture is a followers-only post with a comment, both by author, and
+// the users the policy is checked for
+type policyFixture struct {
+	author, follower, stranger, blocked, moderator *models.User
+	post                                           *models.Post
+	comment                                        *models.Comment
+}
+
+func newPolicyFixture(t *testing.T) *policyFixture {
+	t.Helper()
+
+	f := &policyFixture{
+		author:    createUser(t, "author"),
+		follower:  createUser(t, "follower"),
+		stranger:  createUser(t, "stranger"),
+		blocked:   createUser(t, "blocked"),
+		moderator: createUser(t, "moderator"),
+	}
+	database.DB.Model(f.moderator).Update("role", models.RoleModerator)
+	follow(t, f.follower, f.author)
+	database.DB.Create(&models.Block{BlockerID: f.author.ID, BlockedID: f.blocked.ID})
+
+	f.post = createFeedPost(t, f.author, 0, models.VisibilityFollowers, 10)
+	f.comment = &models.Comment{PostID: f.post.ID, UserID: f.author.ID, Content: "First"}
+	if err := createComment(f.comment); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// policyHandlers are the handlers behind the routes checked here
+type policyHandlers struct {
+	posts      *PostHandler
+	comments   *CommentHandler
+	moderation *ModerationHandler
+	users      *UserHandler
+}
+
+func newPolicyHandlers(t *testing.T) *policyHandlers {
+	t.Helper()
+
+	cfg := testConfig(t)
+	return &policyHandlers{
+		posts:      NewPostHandler(cfg),
+		comments:   NewCommentHandler(cfg),
+		moderation: NewModerationHandler(cfg),
+		users:      NewUserHandler(cfg),
+	}
+}
+
+// policyRoute is a route of cmd/server/main.go that acts on a post or comment
+type policyRoute struct {
+	action policy.Action
+	// onComment routes take a comment ID, the others a post ID
+	onComment bool
+	// list routes don't authorize a single post; the fixture's post must be
+	// listed exactly when the viewer may see it
+	list    bool
+	body    interface{}
+	handler func(*policyHandlers) gin.HandlerFunc
+}
+
+var policyRoutes = map[string]policyRoute{
+	"GET /api/feed/home": {action: policy.View, list: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.GetHomeFeed }},
+	"GET /api/posts": {action: policy.View, list: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.GetPosts }},
+	"GET /api/posts/:id": {action: policy.View,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.GetPost }},
+	"PUT /api/posts/:id": {action: policy.Update, body: UpdatePostRequest{Content: "Edited"},
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.UpdatePost }},
+	"DELETE /api/posts/:id": {action: policy.Delete,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.DeletePost }},
+	"POST /api/posts/:id/like": {action: policy.Like,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.ToggleLike }},
+	"GET /api/posts/:id/likes": {action: policy.View,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.posts.GetPostLikes }},
+	"POST /api/posts/:id/comments": {action: policy.Comment, body: CreateCommentRequest{Content: "Nice"},
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.CreateComment }},
+	"GET /api/posts/:id/comments": {action: policy.View,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.GetComments }},
+	"POST /api/comments/:id/replies": {action: policy.Comment, onComment: true, body: CreateCommentRequest{Content: "Agreed"},
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.CreateReply }},
+	"GET /api/comments/:id/replies": {action: policy.View, onComment: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.GetReplies }},
+	"DELETE /api/comments/:id": {action: policy.Delete, onComment: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.DeleteComment }},
+	"POST /api/comments/:id/like": {action: policy.Like, onComment: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.ToggleLike }},
+	"GET /api/comments/:id/likes": {action: policy.View, onComment: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.comments.GetCommentLikes }},
+	"POST /api/moderation/posts/:id/hide": {action: policy.Moderate,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.moderation.HidePost }},
+	"POST /api/moderation/posts/:id/unhide": {action: policy.Moderate,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.moderation.UnhidePost }},
+	"POST /api/moderation/comments/:id/hide": {action: policy.Moderate, onComment: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.moderation.HideComment }},
+	"POST /api/moderation/comments/:id/unhide": {action: policy.Moderate, onComment: true,
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.moderation.UnhideComment }},
+}
+
+// policyScenarios are the viewers and states of the fixture's post checked
+// on every route, with the status each action gets
+var policyScenarios = []struct {
+	name   string
+	viewer func(*policyFixture) *models.User
+	setup  func(*testing.T, *policyFixture)
+	want   map[policy.Action]int
+}{
+	{
+		name:   "owner",
+		viewer: func(f *policyFixture) *models.User { return f.author },
+		want: map[policy.Action]int{
+			policy.View: http.StatusOK, policy.Comment: http.StatusOK, policy.Like: http.StatusOK,
+			policy.Update: http.StatusOK, policy.Delete: http.StatusOK, policy.Moderate: http.StatusForbidden,
+		},
+	},
+	{
+		name:   "stranger",
+		viewer: func(f *policyFixture) *models.User { return f.stranger },
+		want: map[policy.Action]int{
+			policy.View: http.StatusNotFound, policy.Comment: http.StatusNotFound, policy.Like: http.StatusNotFound,
+			policy.Update: http.StatusForbidden, policy.Delete: http.StatusForbidden, policy.Moderate: http.StatusForbidden,
+		},
+	},
+	{
+		name:   "follower",
+		viewer: func(f *policyFixture) *models.User { return f.follower },
+		want: map[policy.Action]int{
+			policy.View: http.StatusOK, policy.Comment: http.StatusOK, policy.Like: http.StatusOK,
+			policy.Update: http.StatusForbidden, policy.Delete: http.StatusForbidden, policy.Moderate: http.StatusForbidden,
+		},
+	},
+	{
+		name:   "blocked user",
+		viewer: func(f *policyFixture) *models.User { return f.blocked },
+		want: map[policy.Action]int{
+			policy.View: http.StatusNotFound, policy.Comment: http.StatusForbidden, policy.Like: http.StatusForbidden,
+			policy.Update: http.StatusForbidden, policy.Delete: http.StatusForbidden, policy.Moderate: http.StatusForbidden,
+		},
+	},
+	{
+		name:   "moderator",
+		viewer: func(f *policyFixture) *models.User { return f.moderator },
+		want: map[policy.Action]int{
+			policy.View: http.StatusNotFound, policy.Comment: http.StatusNotFound, policy.Like: http.StatusNotFound,
+			policy.Update: http.StatusForbidden, policy.Delete: http.StatusOK, policy.Moderate: http.StatusOK,
+		},
+	},
+	{
+		name:   "hidden post",
+		viewer: func(f *policyFixture) *models.User { return f.follower },
+		setup: func(t *testing.T, f *policyFixture) {
+			database.DB.Model(f.post).Update("hidden_at", time.Now())
+		},
+		want: map[policy.Action]int{
+			policy.View: http.StatusNotFound, policy.Comment: http.StatusNotFound, policy.Like: http.StatusNotFound,
+			policy.Update: http.StatusForbidden, policy.Delete: http.StatusForbidden, policy.Moderate: http.StatusForbidden,
+		},
+	},
+	{
+		name:   "deleted author",
+		viewer: func(f *policyFixture) *models.User { return f.follower },
+		setup: func(t *testing.T, f *policyFixture) {
+			database.DB.Delete(f.author)
+		},
+		want: map[policy.Action]int{
+			policy.View: http.StatusNotFound, policy.Comment: http.StatusNotFound, policy.Like: http.StatusNotFound,
+			policy.Update: http.StatusForbidden, policy.Delete: http.StatusForbidden, policy.Moderate: http.StatusForbidden,
+		},
+	},
+}
+
+// policyStatus is the status the policy answers action with, 200 when it
+// is allowed
+func policyStatus(t *testing.T, v policy.Viewer, route policyRoute, f *policyFixture) int {
+	t.Helper()
+
+	var post models.Post
+	if err := database.DB.Unscoped().First(&post, f.post.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if route.onComment {
+		err = policy.AuthorizeComment(v, route.action, &post, f.comment)
+	} else {
+		err = policy.AuthorizePost(v, route.action, &post)
+	}
+	if err == nil {
+		return http.StatusOK
+	}
+	return err.(*policy.Denial).Status
+}
+
+// listed reports whether a list response contains the post
+func listed(t *testing.T, body *bytes.Buffer, postID uint) bool {
+	t.Helper()
+
+	var page feedPage
+	if err := json.Unmarshal(body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range page.Data {
+		if post.ID == postID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPolicyRoutes(t *testing.T) {
+	for key, route := range policyRoutes {
+		for _, scenario := range policyScenarios {
+			t.Run(key+"/"+scenario.name, func(t *testing.T) {
+				testdb.Open(t)
+				handler := route.handler(newPolicyHandlers(t))
+
+				f := newPolicyFixture(t)
+				if scenario.setup != nil {
+					scenario.setup(t, f)
+				}
+				user := scenario.viewer(f)
+				want, ok := scenario.want[route.action]
+				if !ok {
+					t.Fatalf("scenario has no status for %s", route.action)
+				}
+
+				if got := policyStatus(t, policy.Viewer{ID: user.ID, Role: user.Role}, route, f); got != want {
+					t.Errorf("policy answers %s with %d, want %d", route.action, got, want)
+				}
+
+				if route.list {
+					w := serve(t, handler, http.MethodGet, "/", nil, user.ID)
+					if w.Code != http.StatusOK {
+						t.Fatalf("status = %d: %s", w.Code, w.Body)
+					}
+					if got := listed(t, w.Body, f.post.ID); got != (want == http.StatusOK) {
+						t.Errorf("post listed = %t, but the policy answers view with %d", got, want)
+					}
+					return
+				}
+
+				id := f.post.ID
+				if route.onComment {
+					id = f.comment.ID
+				}
+				method, _, _ := strings.Cut(key, " ")
+				w := serve(t, handler, method, "/", route.body, user.ID, "id", strconv.FormatUint(uint64(id), 10))
+				if got := w.Code; got != want {
+					t.Errorf("status = %d, want %d: %s", got, want, w.Body)
+				}
+			})
+		}
+	}
+}
+
+// A block or audience check that fails must refuse the viewer, not let
+// them through
+func TestPolicyFailsClosed(t *testing.T) {
+	for name, table := range map[string]interface{}{"blocks": &models.Block{}, "follows": &models.Follow{}} {
+		t.Run(name, func(t *testing.T) {
+			testdb.Open(t)
+			h := NewPostHandler(testConfig(t))
+			f := newPolicyFixture(t)
+			if err := database.DB.Migrator().DropTable(table); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, h.GetPost, http.MethodGet, "/", nil, f.follower.ID, "id", strconv.FormatUint(uint64(f.post.ID), 10))
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// userStatuses is the status a /users/:handle route answers for each
+// relation between the viewer and the user
+type userStatuses struct {
+	stranger int
+	// blockedBy viewers were blocked by the user
+	blockedBy int
+	// blocking viewers blocked the user
+	blocking int
+	// deleted users deleted their account
+	deleted int
+}
+
+// userRoutes are the routes of cmd/server/main.go that act on the user
+// named by :handle
+var userRoutes = map[string]struct {
+	handler func(*policyHandlers) gin.HandlerFunc
+	want    userStatuses
+}{
+	"GET /api/users/:handle": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.GetUser },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusNotFound, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"GET /api/users/:handle/followers": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.GetFollowers },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusNotFound, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"GET /api/users/:handle/following": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.GetFollowing },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusNotFound, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"POST /api/users/:handle/follow": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.Follow },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusForbidden, blocking: http.StatusForbidden, deleted: http.StatusNotFound}},
+	"POST /api/users/:handle/close-friend": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.AddCloseFriend },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusForbidden, blocking: http.StatusForbidden, deleted: http.StatusNotFound}},
+	// Undoing a relation, blocking and muting are always allowed
+	"DELETE /api/users/:handle/follow": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.Unfollow },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusOK, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"DELETE /api/users/:handle/close-friend": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.RemoveCloseFriend },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusOK, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"POST /api/users/:handle/block": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.Block },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusOK, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"DELETE /api/users/:handle/block": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.Unblock },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusOK, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"POST /api/users/:handle/mute": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.Mute },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusOK, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+	"DELETE /api/users/:handle/mute": {
+		handler: func(h *policyHandlers) gin.HandlerFunc { return h.users.Unmute },
+		want:    userStatuses{stranger: http.StatusOK, blockedBy: http.StatusOK, blocking: http.StatusOK, deleted: http.StatusNotFound}},
+}
+
+func TestUserRoutes(t *testing.T) {
+	scenarios := []struct {
+		name   string
+		viewer func(*policyFixture) *models.User
+		setup  func(*testing.T, *policyFixture)
+		want   func(userStatuses) int
+	}{
+		{
+			name:   "stranger",
+			viewer: func(f *policyFixture) *models.User { return f.stranger },
+			want:   func(s userStatuses) int { return s.stranger },
+		},
+		{
+			name:   "blocked by the user",
+			viewer: func(f *policyFixture) *models.User { return f.blocked },
+			want:   func(s userStatuses) int { return s.blockedBy },
+		},
+		{
+			name:   "blocking the user",
+			viewer: func(f *policyFixture) *models.User { return f.stranger },
+			setup: func(t *testing.T, f *policyFixture) {
+				database.DB.Create(&models.Block{BlockerID: f.stranger.ID, BlockedID: f.author.ID})
+			},
+			want: func(s userStatuses) int { return s.blocking },
+		},
+		{
+			name:   "deleted user",
+			viewer: func(f *policyFixture) *models.User { return f.stranger },
+			setup: func(t *testing.T, f *policyFixture) {
+				database.DB.Delete(f.author)
+			},
+			want: func(s userStatuses) int { return s.deleted },
+		},
+	}
+
+	for key, route := range userRoutes {
+		for _, scenario := range scenarios {
+			t.Run(key+"/"+scenario.name, func(t *testing.T) {
+				testdb.Open(t)
+				handler := route.handler(newPolicyHandlers(t))
+
+				f := newPolicyFixture(t)
+				if scenario.setup != nil {
+					scenario.setup(t, f)
+				}
+
+				method, _, _ := strings.Cut(key, " ")
+				w := serve(t, handler, method, "/", nil, scenario.viewer(f).ID, "handle", f.author.Handle)
+				if want := scenario.want(route.want); w.Code != want {
+					t.Errorf("status = %d, want %d: %s", w.Code, want, w.Body)
+				}
+			})
+		}
+	}
+}
+
+// unauthorizedRoutes are the routes that act on neither an existing post or
+// comment nor another user, with the reason they need no row above
+var unauthorizedRoutes = map[string]string{
+	"POST /api/auth/register":                "signs up, there is no viewer yet",
+	"POST /api/auth/login":                   "signs in, there is no viewer yet",
+	"POST /api/auth/refresh":                 "authenticated by the refresh token",
+	"POST /api/auth/forgot-password":         "anonymous, only emails the address given",
+	"POST /api/auth/reset-password":          "authenticated by an emailed token",
+	"POST /api/auth/verify-email":            "authenticated by an emailed token",
+	"POST /api/auth/email/confirm":           "authenticated by an emailed token",
+	"POST /api/auth/account/restore":         "authenticated by an emailed token",
+	"POST /api/auth/2fa/verify":              "authenticated by the MFA token",
+	"POST /api/auth/magic-link":              "anonymous, only emails the address given",
+	"POST /api/auth/magic-link/verify":       "authenticated by an emailed token",
+	"POST /api/auth/passkeys/login/begin":    "signs in, there is no viewer yet",
+	"POST /api/auth/passkeys/login/finish":   "signs in, there is no viewer yet",
+	"GET /api/auth/oauth/providers":          "public list of login providers",
+	"GET /api/auth/oauth/:provider":          "signs in, there is no viewer yet",
+	"GET /api/auth/oauth/:provider/callback": "signs in, there is no viewer yet",
+	"POST /api/exports/download":             "authenticated by the emailed download token",
+
+	"GET /api/auth/me":                           "the caller's own account",
+	"POST /api/auth/logout":                      "the caller's own session",
+	"POST /api/auth/logout-all":                  "the caller's own sessions",
+	"GET /api/auth/sessions":                     "the caller's own sessions",
+	"DELETE /api/auth/sessions/:id":              "the caller's own sessions",
+	"POST /api/auth/verify-email/resend":         "the caller's own account",
+	"PUT /api/auth/password":                     "the caller's own account",
+	"POST /api/auth/email":                       "the caller's own account",
+	"POST /api/auth/2fa/setup":                   "the caller's own account",
+	"POST /api/auth/2fa/confirm":                 "the caller's own account",
+	"POST /api/auth/2fa/disable":                 "the caller's own account",
+	"GET /api/auth/identities":                   "the caller's own linked accounts",
+	"DELETE /api/auth/identities/:id":            "the caller's own linked accounts",
+	"POST /api/auth/passkeys/register/begin":     "the caller's own passkeys",
+	"POST /api/auth/passkeys/register/finish":    "the caller's own passkeys",
+	"GET /api/auth/passkeys":                     "the caller's own passkeys",
+	"DELETE /api/auth/passkeys/:id":              "the caller's own passkeys",
+	"POST /api/auth/tokens":                      "the caller's own access tokens",
+	"GET /api/auth/tokens":                       "the caller's own access tokens",
+	"DELETE /api/auth/tokens/:id":                "the caller's own access tokens",
+	"DELETE /api/auth/account":                   "the caller's own account",
+	"POST /api/auth/exports":                     "the caller's own data",
+	"GET /api/auth/exports":                      "the caller's own data",
+	"PUT /api/users/me":                          "the caller's own profile",
+	"GET /api/users/me/blocks":                   "the caller's own block list",
+	"GET /api/users/me/mutes":                    "the caller's own mute list",
+	"GET /api/users/me/close-friends":            "the caller's own close friends",
+	"POST /api/posts":                            "creates a post, there is none to check yet",
+	"POST /api/upload":                           "stores a file owned by the caller",
+	"GET /api/moderation/actions":                "moderation log, guarded by RequirePermission",
+	"GET /api/admin/failed-logins":               "admin only, guarded by RequirePermission",
+	"PUT /api/admin/users/:id/role":              "admin only, guarded by RequirePermission",
+	"POST /api/admin/users/:id/impersonate":      "admin only, guarded by RequirePermission",
+	"GET /api/admin/impersonations":              "admin only, guarded by RequirePermission",
+	"GET /api/admin/impersonations/:id/requests": "admin only, guarded by RequirePermission",
+	"POST /api/admin/impersonations/:id/end":     "admin only, guarded by RequirePermission",
+	"GET /uploads/:filename":                     "public file download",
+	"GET /.well-known/jwks.json":                 "public signing keys",
+	"GET /health":                                "health check",
+}
+
+var (
+	// groupPattern matches route groups in cmd/server/main.go
+	groupPattern = regexp.MustCompile(`(\w+) := (\w+)\.Group\("([^"]*)"\)`)
+	// routePattern matches the routes registered on the router or a group
+	routePattern = regexp.MustCompile(`\b(\w+)\.(GET|POST|PUT|PATCH|DELETE)\("([^"]*)"`)
+)
+
+// TestPolicyRoutesCoverServer fails when a route is added to the server
+// without a row in policyRoutes, userRoutes or unauthorizedRoutes, or a row
+// is left for a removed route
+func TestPolicyRoutesCoverServer(t *testing.T) {
+	source, err := os.ReadFile("../../cmd/server/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefixes := map[string]string{"router": ""}
+	for _, match := range groupPattern.FindAllStringSubmatch(string(source), -1) {
+		parent, ok := prefixes[match[2]]
+		if !ok {
+			t.Fatalf("group %s is defined on unknown group %s", match[1], match[2])
+		}
+		prefixes[match[1]] = parent + match[3]
+	}
+
+	registered := map[string]bool{}
+	for _, match := range routePattern.FindAllStringSubmatch(string(source), -1) {
+		prefix, ok := prefixes[match[1]]
+		if !ok {
+			t.Errorf("route %s %s is registered on unknown group %s", match[2], match[3], match[1])
+			continue
+		}
+		key := match[2] + " " + prefix + match[3]
+		registered[key] = true
+
+		_, checked := policyRoutes[key]
+		if _, ok := userRoutes[key]; ok {
+			checked = true
+		}
+		if !checked && unauthorizedRoutes[key] == "" {
+			t.Errorf("%s has no row in policyRoutes, userRoutes or unauthorizedRoutes", key)
+		}
+	}
+	if len(registered) == 0 {
+		t.Fatal("no routes found in cmd/server/main.go")
+	}
+
+	for _, table := range []map[string]bool{keys(policyRoutes), keys(userRoutes), keys(unauthorizedRoutes)} {
+		for key := range table {
+			if !registered[key] {
+				t.Errorf("%s is not a route of the server", key)
+			}
+		}
+	}
+}
+
+func keys[V any](m map[string]V) map[string]bool {
+	set := make(map[string]bool, len(m))
+	for key := range m {
+		set[key] = true
+	}
+	return set
+}
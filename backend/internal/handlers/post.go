@@ -1,16 +1,19 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/applifylab/social-feed-backend/internal/config"
 	"github.com/applifylab/social-feed-backend/internal/database"
 	"github.com/applifylab/social-feed-backend/internal/middleware"
 	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/timeline"
 	"github.com/applifylab/social-feed-backend/internal/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type PostHandler struct {
@@ -21,15 +24,21 @@ func NewPostHandler(cfg *config.Config) *PostHandler {
 	return &PostHandler{cfg: cfg}
 }
 
+// CreatePostRequest creates a post. Visibility defaults to public; posts
+// visible to specific users list them by handle in Audience.
 type CreatePostRequest struct {
-	Content   string `json:"content" binding:"required"`
-	ImageURL  string `json:"image_url"`
-	IsPrivate bool   `json:"is_private"`
+	Content    string   `json:"content" binding:"required"`
+	ImageURL   string   `json:"image_url"`
+	Visibility string   `json:"visibility"`
+	Audience   []string `json:"audience"`
 }
 
+// UpdatePostRequest changes the fields that are set. Audience replaces the
+// post's audience and is required when switching to specific users.
 type UpdatePostRequest struct {
-	Content   string `json:"content"`
-	IsPrivate *bool  `json:"is_private"`
+	Content    string   `json:"content"`
+	Visibility *string  `json:"visibility"`
+	Audience   []string `json:"audience"`
 }
 
 // CreatePost creates a new post
@@ -42,14 +51,36 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		return
 	}
 
+	if req.Visibility == "" {
+		req.Visibility = models.VisibilityPublic
+	}
+	if !models.IsValidVisibility(req.Visibility) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Unknown visibility")
+		return
+	}
+
+	var audience []uint
+	if req.Visibility == models.VisibilitySpecific {
+		var ok bool
+		if audience, ok = resolveAudience(c, req.Audience); !ok {
+			return
+		}
+	}
+
 	post := models.Post{
-		UserID:    userID,
-		Content:   req.Content,
-		ImageURL:  req.ImageURL,
-		IsPrivate: req.IsPrivate,
+		UserID:     userID,
+		Content:    req.Content,
+		ImageURL:   req.ImageURL,
+		Visibility: req.Visibility,
 	}
 
-	if err := database.DB.Create(&post).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return setAudience(tx, post.ID, audience)
+	})
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to create post")
 		return
 	}
@@ -57,52 +88,39 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 	// Load user data
 	database.DB.Preload("User").First(&post, post.ID)
 
+	// Followers see the post once it reaches their timelines
+	go func(post models.Post) {
+		if err := timeline.FanOut(&post, h.cfg.FanoutMaxFollowers); err != nil {
+			log.Printf("Failed to fan out post %d: %v", post.ID, err)
+		}
+	}(post)
+
 	utils.SuccessResponse(c, post.ToResponse(), "Post created successfully")
 }
 
-// GetPosts retrieves all posts with pagination
+// GetPosts retrieves the posts the user may see, newest first
 func (h *PostHandler) GetPosts(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	offset := (page - 1) * limit
-
-	var posts []models.Post
-	var total int64
-
-	// Get posts (public posts + user's own private posts)
-	query := database.DB.Model(&models.Post{}).
-		Where("is_private = ? OR user_id = ?", false, userID)
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
 
-	query.Count(&total)
+	// Get the posts the user may see
+	query := policy.Posts(database.DB.Model(&models.Post{}), viewer(c))
+	query = withoutMuted(query, userID, "user_id")
 
-	if err := query.
+	var posts []models.Post
+	if err := page.Apply(query, "posts", false).
 		Preload("User").
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
 		Find(&posts).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch posts")
 		return
 	}
+	posts, next := utils.NextPage(posts, page, postKey)
 
-	// Enrich posts with likes and comments count
-	for i := range posts {
-		database.DB.Model(&models.Like{}).
-			Where("likeable_type = ? AND likeable_id = ?", "post", posts[i].ID).
-			Count(&posts[i].LikesCount)
-
-		database.DB.Model(&models.Comment{}).
-			Where("post_id = ? AND parent_comment_id IS NULL", posts[i].ID).
-			Count(&posts[i].CommentsCount)
-
-		// Check if current user liked this post
-		var like models.Like
-		err := database.DB.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?",
-			userID, "post", posts[i].ID).First(&like).Error
-		posts[i].IsLiked = err == nil
-	}
+	enrichPosts(userID, posts)
 
 	// Convert to response
 	postResponses := make([]models.PostResponse, len(posts))
@@ -110,7 +128,7 @@ func (h *PostHandler) GetPosts(c *gin.Context) {
 		postResponses[i] = post.ToResponse()
 	}
 
-	utils.PaginatedSuccessResponse(c, postResponses, page, limit, total)
+	utils.PaginatedSuccessResponse(c, postResponses, page.Limit, next)
 }
 
 // GetPost retrieves a single post by ID
@@ -118,31 +136,13 @@ func (h *PostHandler) GetPost(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 	postID := c.Param("id")
 
-	var post models.Post
-	if err := database.DB.Preload("User").First(&post, postID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Post not found")
+	post, ok := authorizePost(c, policy.View, postID)
+	if !ok {
 		return
 	}
-
-	// Check if user can view this post
-	if post.IsPrivate && post.UserID != userID {
-		utils.ErrorResponse(c, http.StatusForbidden, "forbidden", "You don't have permission to view this post")
-		return
-	}
-
-	// Enrich with counts
-	database.DB.Model(&models.Like{}).
-		Where("likeable_type = ? AND likeable_id = ?", "post", post.ID).
-		Count(&post.LikesCount)
-
-	database.DB.Model(&models.Comment{}).
-		Where("post_id = ? AND parent_comment_id IS NULL", post.ID).
-		Count(&post.CommentsCount)
-
-	var like models.Like
-	err := database.DB.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?",
-		userID, "post", post.ID).First(&like).Error
-	post.IsLiked = err == nil
+	database.DB.First(&post.User, post.UserID)
+	post.IsLiked = likedBy(userID, "post", []uint{post.ID})[post.ID]
+	markFollowed(userID, &post.User)
 
 	utils.SuccessResponse(c, post.ToResponse(), "Post retrieved successfully")
 }
@@ -152,19 +152,26 @@ func (h *PostHandler) DeletePost(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
 	postID := c.Param("id")
 
-	var post models.Post
-	if err := database.DB.First(&post, postID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Post not found")
-		return
-	}
-
-	// Check ownership
-	if post.UserID != userID {
-		utils.ErrorResponse(c, http.StatusForbidden, "forbidden", "You can only delete your own posts")
+	post, ok := authorizePost(c, policy.Delete, postID)
+	if !ok {
 		return
 	}
+	asModerator := post.UserID != userID
 
-	if err := database.DB.Delete(&post).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(post).Error; err != nil {
+			return err
+		}
+		if err := timeline.RemovePosts(tx, post.ID); err != nil {
+			return err
+		}
+		if asModerator {
+			return recordModerationAction(tx, userID, models.ModerationActionDelete,
+				models.ModerationTargetPost, post.ID, post.UserID, c.Query("reason"))
+		}
+		return nil
+	})
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to delete post")
 		return
 	}
@@ -174,18 +181,10 @@ func (h *PostHandler) DeletePost(c *gin.Context) {
 
 // UpdatePost updates a post
 func (h *PostHandler) UpdatePost(c *gin.Context) {
-	userID, _ := middleware.GetUserID(c)
 	postID := c.Param("id")
 
-	var post models.Post
-	if err := database.DB.First(&post, postID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Post not found")
-		return
-	}
-
-	// Check ownership
-	if post.UserID != userID {
-		utils.ErrorResponse(c, http.StatusForbidden, "forbidden", "You can only update your own posts")
+	post, ok := authorizePost(c, policy.Update, postID)
+	if !ok {
 		return
 	}
 
@@ -199,67 +198,127 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 	if req.Content != "" {
 		post.Content = req.Content
 	}
-	if req.IsPrivate != nil {
-		post.IsPrivate = *req.IsPrivate
+	if req.Visibility != nil {
+		if !models.IsValidVisibility(*req.Visibility) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Unknown visibility")
+			return
+		}
+		post.Visibility = *req.Visibility
+	}
+
+	// The audience only matters, and is only kept, for specific users
+	var audience []uint
+	if post.Visibility == models.VisibilitySpecific && (req.Visibility != nil || req.Audience != nil) {
+		var ok bool
+		if audience, ok = resolveAudience(c, req.Audience); !ok {
+			return
+		}
 	}
 
-	if err := database.DB.Save(&post).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the edited columns, so concurrent counter updates aren't lost
+		if err := tx.Model(post).Select("content", "visibility", "updated_at").Updates(post).Error; err != nil {
+			return err
+		}
+		if post.Visibility == models.VisibilitySpecific && audience == nil {
+			return nil
+		}
+		return setAudience(tx, post.ID, audience)
+	})
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update post")
 		return
 	}
 
-	database.DB.Preload("User").First(&post, post.ID)
+	database.DB.Preload("User").First(post, post.ID)
 	utils.SuccessResponse(c, post.ToResponse(), "Post updated successfully")
 }
 
 // ToggleLike toggles like on a post
 func (h *PostHandler) ToggleLike(c *gin.Context) {
 	userID, _ := middleware.GetUserID(c)
-	postID := c.Param("id")
 
-	// Check if post exists
-	var post models.Post
-	if err := database.DB.First(&post, postID).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "not_found", "Post not found")
+	post, ok := authorizePost(c, policy.Like, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	// Check if already liked
-	var like models.Like
-	err := database.DB.Where("user_id = ? AND likeable_type = ? AND likeable_id = ?",
-		userID, "post", postID).First(&like).Error
+	liked, err := toggleLike(userID, "post", post.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update like")
+		return
+	}
 
-	if err == nil {
-		// Unlike
-		database.DB.Delete(&like)
-		utils.SuccessResponse(c, gin.H{"liked": false}, "Post unliked")
-	} else {
-		// Like
-		like = models.Like{
-			UserID:       userID,
-			LikeableType: "post",
-			LikeableID:   post.ID,
-		}
-		database.DB.Create(&like)
+	if liked {
 		utils.SuccessResponse(c, gin.H{"liked": true}, "Post liked")
+	} else {
+		utils.SuccessResponse(c, gin.H{"liked": false}, "Post unliked")
 	}
 }
 
-// GetPostLikes retrieves users who liked a post
+// GetPostLikes retrieves users who liked a post, most recent first
 func (h *PostHandler) GetPostLikes(c *gin.Context) {
-	postID := c.Param("id")
+	post, ok := authorizePost(c, policy.View, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	listLikes(c, "post", post.ID)
+}
+
+// listLikes pages through the users who liked a post or comment the current
+// user may see
+func listLikes(c *gin.Context, likeableType string, likeableID uint) {
+	userID, _ := middleware.GetUserID(c)
+
+	page, ok := utils.ParsePage(c, 20)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Where("likeable_type = ? AND likeable_id = ?", likeableType, likeableID)
 
 	var likes []models.Like
-	if err := database.DB.Where("likeable_type = ? AND likeable_id = ?", "post", postID).
-		Preload("User").Find(&likes).Error; err != nil {
+	if err := page.Apply(policy.Likes(query, viewer(c)), "likes", false).
+		Preload("User").
+		Find(&likes).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to fetch likes")
 		return
 	}
+	likes, next := utils.NextPage(likes, page, func(l *models.Like) (time.Time, uint) {
+		return l.CreatedAt, l.ID
+	})
+
+	likers := make([]*models.User, len(likes))
+	for i := range likes {
+		likers[i] = &likes[i].User
+	}
+	markFollowed(userID, likers...)
 
 	users := make([]models.UserResponse, len(likes))
 	for i, like := range likes {
 		users[i] = like.User.ToResponse()
 	}
 
-	utils.SuccessResponse(c, users, fmt.Sprintf("%d users liked this post", len(users)))
+	utils.PaginatedSuccessResponse(c, users, page.Limit, next)
+}
+
+func postKey(p *models.Post) (time.Time, uint) {
+	return p.CreatedAt, p.ID
+}
+
+// enrichPosts fills in the viewer's likes and follows on a page of posts
+func enrichPosts(userID uint, posts []models.Post) {
+	ids := make([]uint, len(posts))
+	authors := make([]*models.User, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+		authors[i] = &posts[i].User
+	}
+
+	liked := likedBy(userID, "post", ids)
+	for i := range posts {
+		posts[i].IsLiked = liked[posts[i].ID]
+	}
+	markFollowed(userID, authors...)
 }
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// refreshTokenBytes is the amount of randomness in a refresh token
+const refreshTokenBytes = 32
+
+// issueSession starts a new session for the user on the requesting device
+// and returns its tokens
+func issueSession(c *gin.Context, cfg *config.Config, user *models.User) (*AuthResponse, error) {
+	var resp *AuthResponse
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.Session{
+			UserID:     user.ID,
+			UserAgent:  truncate(c.Request.UserAgent(), 500),
+			IPAddress:  c.ClientIP(),
+			LastSeenAt: &now,
+			ExpiresAt:  now.Add(cfg.RefreshTokenTTL),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		resp, err = issueTokens(tx, cfg, user, &session)
+		return err
+	})
+	return resp, err
+}
+
+// rotateRefreshToken exchanges a refresh token for a new token pair. Presenting
+// a token that has already been rotated revokes the whole session, since it
+// means the token was copied by someone else.
+func rotateRefreshToken(c *gin.Context, cfg *config.Config, rawToken string) (*AuthResponse, error) {
+	var refreshToken models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(rawToken)).First(&refreshToken).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	var session models.Session
+	if err := database.DB.Preload("User").First(&session, refreshToken.SessionID).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	if refreshToken.UsedAt != nil {
+		revokeSession(database.DB, &session)
+		return nil, errRefreshTokenReused
+	}
+
+	if !session.IsActive() || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	var resp *AuthResponse
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Mark the token as used only if nobody beat us to it
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", refreshToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		now := time.Now()
+		session.ExpiresAt = now.Add(cfg.RefreshTokenTTL)
+		session.LastSeenAt = &now
+		session.IPAddress = c.ClientIP()
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"expires_at":   session.ExpiresAt,
+			"last_seen_at": now,
+			"ip_address":   session.IPAddress,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		resp, err = issueTokens(tx, cfg, &session.User, &session)
+		return err
+	})
+
+	if errors.Is(err, errRefreshTokenReused) {
+		revokeSession(database.DB, &session)
+	}
+	return resp, err
+}
+
+// issueTokens creates a refresh token for the session and a matching access token
+func issueTokens(tx *gorm.DB, cfg *config.Config, user *models.User, session *models.Session) (*AuthResponse, error) {
+	rawRefreshToken, err := utils.GenerateRandomToken(refreshTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: utils.HashToken(rawRefreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateToken(&utils.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.IsEmailVerified(),
+		Role:          user.Role,
+		SessionID:     session.ID,
+		TokenVersion:  user.TokenVersion,
+	}, auth.Keys, cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        accessToken,
+		RefreshToken: rawRefreshToken,
+		ExpiresIn:    int64(cfg.AccessTokenTTL.Seconds()),
+		User:         user.ToAccountResponse(),
+	}, nil
+}
+
+// revokeSession marks a session as revoked so none of its tokens work
+func revokeSession(tx *gorm.DB, session *models.Session) error {
+	if session.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	if err := tx.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", session.ID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	auth.MarkSessionRevoked(session.ID)
+	return nil
+}
+
+// revokeUserSessions revokes every active session of a user
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
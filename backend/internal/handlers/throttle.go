@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// checkLoginAllowed answers with 429 (IP throttled) or 423 (account locked)
+// and returns false if the login attempt must be rejected
+func (h *AuthHandler) checkLoginAllowed(c *gin.Context, email string, userID *uint) bool {
+	err := auth.CheckLoginAllowed(email, c.ClientIP())
+	if err == nil {
+		return true
+	}
+
+	var lockout *auth.LockoutError
+	if !errors.As(err, &lockout) {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to process login")
+		return false
+	}
+
+	reason := models.LoginFailureThrottled
+	if lockout.Account {
+		reason = models.LoginFailureLocked
+	}
+	if err := auth.AuditFailedLogin(newFailedLogin(c, email, userID, reason)); err != nil {
+		log.Printf("Failed to audit login attempt: %v", err)
+	}
+
+	c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(lockout.RetryAfter.Seconds()))))
+	if lockout.Account {
+		utils.ErrorResponse(c, http.StatusLocked, "account_locked", "Too many failed login attempts, please try again later")
+	} else {
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "too_many_requests", "Too many login attempts, please try again later")
+	}
+	return false
+}
+
+// recordLoginFailure counts a failed attempt towards the lockout thresholds
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, email string, userID *uint, reason string) {
+	if err := auth.RecordLoginFailure(h.cfg, newFailedLogin(c, email, userID, reason)); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+// recordLoginSuccess resets the account's failure count
+func (h *AuthHandler) recordLoginSuccess(email string) {
+	if err := auth.RecordLoginSuccess(email); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+}
+
+func newFailedLogin(c *gin.Context, email string, userID *uint, reason string) models.FailedLogin {
+	return models.FailedLogin{
+		Email:     email,
+		UserID:    userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: truncate(c.Request.UserAgent(), 500),
+		Reason:    reason,
+	}
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
 	"github.com/applifylab/social-feed-backend/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -78,8 +81,17 @@ func (h *UploadHandler) UploadImage(c *gin.Context) {
 		return
 	}
 
-	// Return URL
+	// Record the uploader, so the file can be removed with their account and
+	// nobody else can claim it as an avatar
+	userID, _ := middleware.GetUserID(c)
 	imageURL := fmt.Sprintf("/uploads/%s", filename)
+	if err := database.DB.Create(&models.Upload{UserID: userID, URL: imageURL}).Error; err != nil {
+		os.Remove(filePath)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to save file")
+		return
+	}
+
+	// Return URL
 	utils.SuccessResponse(c, gin.H{
 		"url":      imageURL,
 		"filename": filename,
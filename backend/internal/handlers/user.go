@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/policy"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errHandleTaken = errors.New("handle already taken")
+
+type UserHandler struct {
+	cfg *config.Config
+}
+
+func NewUserHandler(cfg *config.Config) *UserHandler {
+	return &UserHandler{cfg: cfg}
+}
+
+// UpdateProfileRequest changes the fields that are set. Bio, avatar,
+// location and website are cleared with an empty string.
+type UpdateProfileRequest struct {
+	FirstName *string `json:"first_name" binding:"omitempty,min=1,max=100"`
+	LastName  *string `json:"last_name" binding:"omitempty,min=1,max=100"`
+	Handle    *string `json:"handle"`
+	Bio       *string `json:"bio" binding:"omitempty,max=500"`
+	AvatarURL *string `json:"avatar_url"`
+	Location  *string `json:"location" binding:"omitempty,max=100"`
+	Website   *string `json:"website" binding:"omitempty,max=255"`
+}
+
+// GetUser retrieves a user's public profile by handle
+func (h *UserHandler) GetUser(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	user, ok := findVisibleUser(c, userID)
+	if !ok {
+		return
+	}
+	markFollowed(userID, user)
+
+	profile := models.ProfileResponse{UserResponse: user.ToResponse()}
+	policy.WithoutDeletedUsers(database.DB.Model(&models.Follow{}), "follower_id").
+		Where("followee_id = ?", user.ID).
+		Count(&profile.FollowersCount)
+	policy.WithoutDeletedUsers(database.DB.Model(&models.Follow{}), "followee_id").
+		Where("follower_id = ?", user.ID).
+		Count(&profile.FollowingCount)
+
+	var followsYou int64
+	database.DB.Model(&models.Follow{}).
+		Where("follower_id = ? AND followee_id = ?", user.ID, userID).
+		Count(&followsYou)
+	profile.FollowsYou = followsYou > 0
+
+	var blocked, muted int64
+	database.DB.Model(&models.Block{}).
+		Where("blocker_id = ? AND blocked_id = ?", userID, user.ID).
+		Count(&blocked)
+	database.DB.Model(&models.Mute{}).
+		Where("muter_id = ? AND muted_id = ?", userID, user.ID).
+		Count(&muted)
+	profile.Blocked = blocked > 0
+	profile.Muted = muted > 0
+
+	utils.SuccessResponse(c, profile, "User retrieved successfully")
+}
+
+// UpdateMe updates the current user's profile
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if req.FirstName != nil {
+		user.FirstName = strings.TrimSpace(*req.FirstName)
+	}
+	if req.LastName != nil {
+		user.LastName = strings.TrimSpace(*req.LastName)
+	}
+	if req.Bio != nil {
+		user.Bio = strings.TrimSpace(*req.Bio)
+	}
+	if req.Location != nil {
+		user.Location = strings.TrimSpace(*req.Location)
+	}
+
+	if req.Handle != nil {
+		handle := strings.ToLower(strings.TrimPrefix(*req.Handle, "@"))
+		if !models.IsValidHandle(handle) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "validation_error",
+				"Handle must be 3 to 30 letters, digits or underscores")
+			return
+		}
+		user.Handle = handle
+	}
+
+	if req.Website != nil {
+		website := strings.TrimSpace(*req.Website)
+		if website != "" && !isWebURL(website) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Website must be an http or https URL")
+			return
+		}
+		user.Website = website
+	}
+
+	// Avatars are uploaded through /api/upload first, by the user themselves.
+	// Sending the current avatar back is fine.
+	if req.AvatarURL != nil && *req.AvatarURL != user.AvatarURL {
+		if *req.AvatarURL != "" && !h.isOwnUpload(user.ID, *req.AvatarURL) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Avatar must be an image you uploaded to /api/upload")
+			return
+		}
+		user.AvatarURL = *req.AvatarURL
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Handle != nil {
+			var count int64
+			tx.Unscoped().Model(&models.User{}).
+				Where("handle = ? AND id <> ?", user.Handle, user.ID).
+				Count(&count)
+			if count > 0 {
+				return errHandleTaken
+			}
+		}
+
+		return tx.Model(&user).Select("first_name", "last_name", "handle", "bio", "avatar_url", "location", "website").
+			Updates(&user).Error
+	})
+	// Someone may have taken the handle since it was checked
+	if errors.Is(err, errHandleTaken) || database.IsUniqueViolation(err) {
+		utils.ErrorResponse(c, http.StatusConflict, "handle_taken", "This handle is already taken")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to update profile")
+		return
+	}
+
+	utils.SuccessResponse(c, user.ToAccountResponse(), "Profile updated successfully")
+}
+
+// isOwnUpload reports whether imageURL points at an existing file the user
+// uploaded
+func (h *UserHandler) isOwnUpload(userID uint, imageURL string) bool {
+	filePath, ok := utils.UploadPath(h.cfg.UploadDir, imageURL)
+	if !ok {
+		return false
+	}
+
+	var count int64
+	database.DB.Model(&models.Upload{}).Where("user_id = ? AND url = ?", userID, imageURL).Count(&count)
+	if count == 0 {
+		return false
+	}
+	_, err := os.Stat(filePath)
+	return err == nil
+}
+
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// newHandle picks a free handle for a new user, derived from seed (such as
+// the part of their email before the @) with a number added if needed
+func newHandle(tx *gorm.DB, seed string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return -1
+	}, seed)
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 {
+		base = "user" + base
+	}
+
+	handle := base
+	for i := 0; i < 10; i++ {
+		if models.IsValidHandle(handle) {
+			var count int64
+			if err := tx.Unscoped().Model(&models.User{}).Where("handle = ?", handle).Count(&count).Error; err != nil {
+				return "", err
+			}
+			if count == 0 {
+				return handle, nil
+			}
+		}
+		handle = fmt.Sprintf("%s%d", base, rand.IntN(100000))
+	}
+	return "", errHandleTaken
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+)
+
+// storeUpload writes an uploaded file owned by the user and returns its URL
+func storeUpload(t *testing.T, uploadDir string, user *models.User, filename string) string {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(uploadDir, filename), []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	url := "/uploads/" + filename
+	if err := database.DB.Create(&models.Upload{UserID: user.ID, URL: url}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return url
+}
+
+func TestUpdateMeAvatarMustBeOwnUpload(t *testing.T) {
+	testdb.Open(t)
+	cfg := testConfig(t)
+	cfg.UploadDir = t.TempDir()
+	h := NewUserHandler(cfg)
+
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+	aliceImage := storeUpload(t, cfg.UploadDir, alice, "alice.png")
+	bobImage := storeUpload(t, cfg.UploadDir, bob, "bob.png")
+
+	tests := []struct {
+		name      string
+		avatarURL string
+		want      int
+	}{
+		{"another user's upload", aliceImage, http.StatusBadRequest},
+		{"missing file", "/uploads/missing.png", http.StatusBadRequest},
+		{"external URL", "https://example.com/avatar.png", http.StatusBadRequest},
+		{"own upload", bobImage, http.StatusOK},
+		{"current avatar", bobImage, http.StatusOK},
+		{"no avatar", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, h.UpdateMe, http.MethodPut, "/", UpdateProfileRequest{AvatarURL: &tt.avatarURL}, bob.ID)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// A user who blocked the viewer looks like they don't exist, on their
+// profile and their follower lists alike
+func TestBlockerLooksMissing(t *testing.T) {
+	testdb.Open(t)
+	h := NewUserHandler(testConfig(t))
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+	carol := createUser(t, "carol")
+	database.DB.Create(&models.Block{BlockerID: alice.ID, BlockedID: bob.ID})
+
+	for name, handler := range map[string]func(*gin.Context){
+		"profile":   h.GetUser,
+		"followers": h.GetFollowers,
+		"following": h.GetFollowing,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if w := serve(t, handler, http.MethodGet, "/", nil, bob.ID, "handle", "alice"); w.Code != http.StatusNotFound {
+				t.Errorf("blocked viewer: status = %d, want 404", w.Code)
+			}
+			// The block only hides alice from bob
+			if w := serve(t, handler, http.MethodGet, "/", nil, carol.ID, "handle", "alice"); w.Code != http.StatusOK {
+				t.Errorf("other viewer: status = %d, want 200", w.Code)
+			}
+			if w := serve(t, handler, http.MethodGet, "/", nil, alice.ID, "handle", "bob"); w.Code != http.StatusOK {
+				t.Errorf("blocker: status = %d, want 200", w.Code)
+			}
+		})
+	}
+}
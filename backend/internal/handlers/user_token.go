@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidUserToken = errors.New("invalid or expired token")
+	errAccountDeleted   = errors.New("account is deleted")
+)
+
+// userTokenBytes is the amount of randomness in an emailed token
+const userTokenBytes = 32
+
+// createUserToken invalidates the user's outstanding tokens for purpose and
+// returns a fresh one valid for ttl
+func createUserToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	return createUserTokenWithData(tx, userID, purpose, "", ttl)
+}
+
+// createUserTokenWithData is createUserToken with extra data stored alongside
+// the token, such as the address an email change is waiting to confirm
+func createUserTokenWithData(tx *gorm.DB, userID uint, purpose, data string, ttl time.Duration) (string, error) {
+	if err := tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error; err != nil {
+		return "", err
+	}
+
+	rawToken, err := utils.GenerateRandomToken(userTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	token := models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(rawToken),
+		Data:      data,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// consumeUserToken marks a token as used and returns it with its user. It
+// fails if the token is unknown, expired, already used or meant for another purpose,
+// and with errAccountDeleted if its user deleted their account since.
+func consumeUserToken(tx *gorm.DB, rawToken, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := tx.Preload("User").
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(rawToken), purpose).
+		First(&token).Error; err != nil {
+		return nil, errInvalidUserToken
+	}
+
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, errInvalidUserToken
+	}
+
+	// Deleted users aren't preloaded. Restore tokens are the only ones
+	// meant for them.
+	if token.User.ID == 0 && purpose != models.TokenPurposeAccountRestore {
+		return nil, errAccountDeleted
+	}
+
+	// Only one request may redeem the token
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidUserToken
+	}
+	return &token, nil
+}
+
+// accountDeletedResponse tells a user acting on a deleted account how to get
+// it back
+func accountDeletedResponse(c *gin.Context) {
+	utils.ErrorResponse(c, http.StatusUnauthorized, "account_deleted",
+		"This account has been deleted. Use the link in the deletion email to restore it")
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/middleware"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// verificationResendInterval is the minimum time between verification emails
+const verificationResendInterval = time.Minute
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail confirms a user's email address using the emailed token
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, req.Token, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		user = token.User
+
+		if user.IsEmailVerified() {
+			return nil
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		return tx.Model(&user).Update("email_verified_at", now).Error
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "invalid_token", "Invalid or expired verification token")
+		return
+	}
+	if errors.Is(err, errAccountDeleted) {
+		accountDeletedResponse(c)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to verify email")
+		return
+	}
+
+	utils.SuccessResponse(c, user.ToAccountResponse(), "Email verified successfully")
+}
+
+// ResendVerification sends a new verification email to the current user
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := middleware.GetUserID(c)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if user.IsEmailVerified() {
+		utils.ErrorResponse(c, http.StatusBadRequest, "already_verified", "Email is already verified")
+		return
+	}
+
+	var recent int64
+	database.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?",
+			user.ID, models.TokenPurposeEmailVerification, time.Now().Add(-verificationResendInterval)).
+		Count(&recent)
+	if recent > 0 {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(verificationResendInterval.Seconds())))
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "too_many_requests", "Please wait before requesting another verification email")
+		return
+	}
+
+	if err := h.sendVerificationEmail(&user); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to send verification email")
+		return
+	}
+
+	utils.SuccessResponse(c, nil, "Verification email sent")
+}
+
+// sendVerificationEmail creates a verification token and emails the link
+func (h *AuthHandler) sendVerificationEmail(user *models.User) error {
+	token, err := createUserToken(database.DB, user.ID, models.TokenPurposeEmailVerification, h.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.cfg.AppURL, url.QueryEscape(token))
+	h.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.FirstName, h.cfg.EmailVerificationTTL, link),
+	})
+	return nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAudience is how many users a post with "specific" visibility can be
+// shared with
+const maxAudience = 100
+
+// resolveAudience looks up the users a post is shared with by handle,
+// responding with 400 if any of them doesn't exist
+func resolveAudience(c *gin.Context, handles []string) ([]uint, bool) {
+	if len(handles) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Posts visible to specific users need an audience")
+		return nil, false
+	}
+	if len(handles) > maxAudience {
+		utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "A post can be shared with at most 100 users")
+		return nil, false
+	}
+
+	normalized := make([]string, len(handles))
+	for i, handle := range handles {
+		normalized[i] = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	}
+
+	var users []models.User
+	if err := database.DB.Where("handle IN ? AND anonymized_at IS NULL", normalized).Find(&users).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "server_error", "Failed to look up audience")
+		return nil, false
+	}
+
+	found := make(map[string]bool, len(users))
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		found[u.Handle] = true
+		ids[i] = u.ID
+	}
+	for _, handle := range normalized {
+		if !found[handle] {
+			utils.ErrorResponse(c, http.StatusBadRequest, "validation_error", "Unknown user @"+handle)
+			return nil, false
+		}
+	}
+	return ids, true
+}
+
+// setAudience replaces the users a post is shared with
+func setAudience(tx *gorm.DB, postID uint, userIDs []uint) error {
+	if err := tx.Where("post_id = ?", postID).Delete(&models.PostAudience{}).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	audience := make([]models.PostAudience, len(userIDs))
+	for i, id := range userIDs {
+		audience[i] = models.PostAudience{PostID: postID, UserID: id}
+	}
+	return tx.Create(&audience).Error
+}
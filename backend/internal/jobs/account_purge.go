@@ -0,0 +1,302 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/counters"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deletedContent replaces the text of posts and comments that are kept
+// because other users replied to them
+const deletedContent = "[deleted]"
+
+// PurgeDeletedAccounts removes the data of accounts deleted longer than the
+// grace period ago. Posts and comments other users replied to are anonymized
+// instead, so the replies keep their place in the thread. The user row is
+// kept as an anonymized placeholder for the content that remains.
+func PurgeDeletedAccounts(cfg *config.Config) error {
+	cutoff := time.Now().Add(-cfg.AccountDeletionGrace)
+
+	var userIDs []uint
+	if err := database.DB.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &userIDs).Error; err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		var images, exports []string
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			images, exports, err = purgeAccount(tx, userID, cutoff)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to purge user %d: %w", userID, err)
+		}
+		removeUploads(cfg.UploadDir, images)
+		for _, filePath := range exports {
+			removeExportFile(filePath)
+		}
+	}
+
+	if len(userIDs) > 0 {
+		log.Printf("Purged %d deleted accounts", len(userIDs))
+	}
+	return nil
+}
+
+// purgeAccount removes or anonymizes everything belonging to a deleted user.
+// It returns the URLs of the images they uploaded and the paths of their data
+// exports, whose files can be removed once the transaction has committed.
+func purgeAccount(tx *gorm.DB, userID uint, cutoff time.Time) (images, exports []string, err error) {
+	// Another instance may have purged the account, or the user restored it
+	var user models.User
+	err = tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", userID, cutoff).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Removing the user's likes and comments changes counts on other
+	// users' posts and comments, which are recounted at the end
+	postIDs, commentIDs, err := countedBy(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Like{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("follower_id = ? OR followee_id = ?", userID, userID).Delete(&models.Follow{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("user_id = ? OR author_id = ?", userID, userID).Delete(&models.TimelineEntry{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("blocker_id = ? OR blocked_id = ?", userID, userID).Delete(&models.Block{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("muter_id = ? OR muted_id = ?", userID, userID).Delete(&models.Mute{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("user_id = ? OR friend_id = ?", userID, userID).Delete(&models.CloseFriend{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.PostAudience{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := purgeComments(tx, userID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := purgePosts(tx, userID); err != nil {
+		return nil, nil, err
+	}
+	if images, err = purgeUploads(tx, userID); err != nil {
+		return nil, nil, err
+	}
+	if err := counters.Recount(tx, postIDs, commentIDs); err != nil {
+		return nil, nil, err
+	}
+
+	if err := purgeCredentials(tx, userID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Model(&models.DataExport{}).
+		Where("user_id = ? AND file_path <> ''", userID).
+		Pluck("file_path", &exports).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.DataExport{}).Error; err != nil {
+		return nil, nil, err
+	}
+
+	email := fmt.Sprintf("deleted-%d@deleted.invalid", userID)
+	if err := tx.Model(&models.FailedLogin{}).
+		Where("user_id = ?", userID).
+		Update("email", email).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return images, exports, tx.Unscoped().Model(&user).Updates(map[string]interface{}{
+		"first_name":        "Deleted",
+		"last_name":         "User",
+		"email":             email,
+		"handle":            fmt.Sprintf("deleted-%d", userID), // can't be chosen, handles have no dashes
+		"bio":               "",
+		"avatar_url":        "",
+		"location":          "",
+		"website":           "",
+		"password_hash":     "",
+		"token_version":     gorm.Expr("token_version + 1"),
+		"role":              models.RoleUser,
+		"email_verified_at": nil,
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_step":    0,
+		"webauthn_handle":   nil,
+		"anonymized_at":     time.Now(),
+		"deleted_at":        nil,
+	}).Error
+}
+
+// countedBy returns the posts and comments whose counters include a like,
+// comment or reply of the user
+func countedBy(tx *gorm.DB, userID uint) (postIDs, commentIDs []uint, err error) {
+	var likedPosts, likedComments, commented, replied []uint
+	if err := tx.Model(&models.Like{}).
+		Where("user_id = ? AND likeable_type = ?", userID, "post").
+		Distinct().Pluck("likeable_id", &likedPosts).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Unscoped().Model(&models.Comment{}).
+		Where("user_id = ? AND parent_comment_id IS NULL", userID).
+		Distinct().Pluck("post_id", &commented).Error; err != nil {
+		return nil, nil, err
+	}
+	postIDs = append(likedPosts, commented...)
+
+	if err := tx.Model(&models.Like{}).
+		Where("user_id = ? AND likeable_type = ?", userID, "comment").
+		Distinct().Pluck("likeable_id", &likedComments).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Unscoped().Model(&models.Comment{}).
+		Where("user_id = ? AND parent_comment_id IS NOT NULL", userID).
+		Distinct().Pluck("parent_comment_id", &replied).Error; err != nil {
+		return nil, nil, err
+	}
+	commentIDs = append(likedComments, replied...)
+	return postIDs, commentIDs, nil
+}
+
+// purgeComments deletes the user's comments nobody replied to and blanks out
+// the rest. Deleting a reply can leave its parent without replies, so this
+// repeats until nothing more can be deleted.
+func purgeComments(tx *gorm.DB, userID uint) error {
+	for {
+		var ids []uint
+		if err := tx.Unscoped().Model(&models.Comment{}).
+			Where("user_id = ? AND NOT EXISTS (SELECT 1 FROM comments replies WHERE replies.parent_comment_id = comments.id)", userID).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		if err := deleteLikesOn(tx, "comment", ids); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.Comment{}, ids).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Model(&models.Comment{}).
+		Where("user_id = ?", userID).
+		Update("content", deletedContent).Error
+}
+
+// purgePosts deletes the user's posts without comments and blanks out the rest
+func purgePosts(tx *gorm.DB, userID uint) error {
+	var ids []uint
+	if err := tx.Unscoped().Model(&models.Post{}).
+		Where("user_id = ? AND NOT EXISTS (SELECT 1 FROM comments WHERE comments.post_id = posts.id)", userID).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		if err := deleteLikesOn(tx, "post", ids); err != nil {
+			return err
+		}
+		if err := tx.Where("post_id IN ?", ids).Delete(&models.PostAudience{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.Post{}, ids).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Model(&models.Post{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"content":   deletedContent,
+			"image_url": "",
+		}).Error
+}
+
+// purgeUploads forgets the images the user uploaded and returns the URLs of
+// those no longer shown anywhere. It runs after the user's posts are purged,
+// so any post or avatar still using an image belongs to someone else, and
+// that image is kept.
+func purgeUploads(tx *gorm.DB, userID uint) ([]string, error) {
+	var images []string
+	if err := tx.Model(&models.Upload{}).
+		Where("user_id = ?", userID).
+		Where("NOT EXISTS (SELECT 1 FROM posts WHERE posts.image_url = uploads.url)").
+		Where("NOT EXISTS (SELECT 1 FROM users WHERE users.avatar_url = uploads.url AND users.id <> ?)", userID).
+		Pluck("url", &images).Error; err != nil {
+		return nil, err
+	}
+	return images, tx.Where("user_id = ?", userID).Delete(&models.Upload{}).Error
+}
+
+// purgeCredentials deletes everything the user could log in or act with
+func purgeCredentials(tx *gorm.DB, userID uint) error {
+	sessions := tx.Model(&models.Session{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("session_id IN (?)", sessions).Delete(&models.RefreshToken{}).Error; err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{
+		&models.Session{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.Passkey{},
+		&models.PasskeyChallenge{},
+		&models.PersonalAccessToken{},
+	} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteLikesOn(tx *gorm.DB, likeableType string, ids []uint) error {
+	return tx.Where("likeable_type = ? AND likeable_id IN ?", likeableType, ids).
+		Delete(&models.Like{}).Error
+}
+
+// removeUploads deletes uploaded image files. Failures are only logged, the
+// account itself has already been purged.
+func removeUploads(uploadDir string, imageURLs []string) {
+	for _, imageURL := range imageURLs {
+		filePath, ok := utils.UploadPath(uploadDir, imageURL)
+		if !ok {
+			continue
+		}
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove upload %s: %v", filePath, err)
+		}
+	}
+}
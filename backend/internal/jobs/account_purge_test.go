@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+)
+
+func createUser(t *testing.T, handle string) *models.User {
+	t.Helper()
+
+	user := models.User{FirstName: "Test", LastName: handle, Handle: handle, Email: handle + "@example.com", Role: models.RoleUser}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// upload stores a file in the upload directory on behalf of the user
+func upload(t *testing.T, dir string, user *models.User, filename string) string {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, filename), []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	url := "/uploads/" + filename
+	if err := database.DB.Create(&models.Upload{UserID: user.ID, URL: url}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return url
+}
+
+func deleteAccount(t *testing.T, user *models.User, at time.Time) {
+	t.Helper()
+
+	if err := database.DB.Model(user).Update("deleted_at", at).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(dir, filename string) bool {
+	_, err := os.Stat(filepath.Join(dir, filename))
+	return err == nil
+}
+
+func TestPurgeRemovesOnlyOwnUploads(t *testing.T) {
+	testdb.Open(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), AccountDeletionGrace: time.Hour}
+
+	victim := createUser(t, "victim")
+	attacker := createUser(t, "attacker")
+
+	victimImage := upload(t, cfg.UploadDir, victim, "victim.png")
+	victimAvatar := upload(t, cfg.UploadDir, victim, "avatar.png")
+	database.DB.Model(victim).Update("avatar_url", victimAvatar)
+	database.DB.Create(&models.Post{UserID: victim.ID, Content: "Mine", ImageURL: victimImage})
+
+	// The attacker posts the victim's images as their own
+	ownImage := upload(t, cfg.UploadDir, attacker, "attacker.png")
+	for _, imageURL := range []string{victimImage, victimAvatar, ownImage} {
+		database.DB.Create(&models.Post{UserID: attacker.ID, Content: "Stolen", ImageURL: imageURL})
+	}
+	database.DB.Model(attacker).Update("avatar_url", victimAvatar)
+
+	deleteAccount(t, attacker, time.Now().Add(-2*time.Hour))
+	if err := PurgeDeletedAccounts(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{"victim.png", "avatar.png"} {
+		if !exists(cfg.UploadDir, filename) {
+			t.Errorf("%s of another user was removed", filename)
+		}
+	}
+	if exists(cfg.UploadDir, "attacker.png") {
+		t.Error("the purged user's own upload was kept")
+	}
+
+	var count int64
+	database.DB.Model(&models.Upload{}).Where("user_id = ?", attacker.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d uploads of the purged user are still recorded", count)
+	}
+}
+
+func TestPurgeKeepsOwnUploadsOthersUse(t *testing.T) {
+	testdb.Open(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), AccountDeletionGrace: time.Hour}
+
+	author := createUser(t, "author")
+	other := createUser(t, "other")
+
+	shared := upload(t, cfg.UploadDir, author, "shared.png")
+	database.DB.Create(&models.Post{UserID: author.ID, Content: "Original", ImageURL: shared})
+	database.DB.Create(&models.Post{UserID: other.ID, Content: "Repost", ImageURL: shared})
+
+	deleteAccount(t, author, time.Now().Add(-2*time.Hour))
+	if err := PurgeDeletedAccounts(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists(cfg.UploadDir, "shared.png") {
+		t.Error("an upload still shown in another user's post was removed")
+	}
+}
+
+func TestPurgeWaitsForGracePeriod(t *testing.T) {
+	testdb.Open(t)
+	cfg := &config.Config{UploadDir: t.TempDir(), AccountDeletionGrace: time.Hour}
+
+	user := createUser(t, "recent")
+	image := upload(t, cfg.UploadDir, user, "recent.png")
+	database.DB.Create(&models.Post{UserID: user.ID, Content: "Still here", ImageURL: image})
+
+	deleteAccount(t, user, time.Now().Add(-time.Minute))
+	if err := PurgeDeletedAccounts(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists(cfg.UploadDir, "recent.png") {
+		t.Error("upload of an account still in its grace period was removed")
+	}
+}
@@ -0,0 +1,522 @@
+package jobs
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/mailer"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// staleExportAfter is how long an export may stay in processing before it is
+// assumed the instance building it went away and it is queued again
+const staleExportAfter = time.Hour
+
+// exportTokenBytes is the amount of randomness in a download token
+const exportTokenBytes = 32
+
+// ProcessDataExports builds the archives of pending data exports and emails
+// their download links, then removes archives whose link has expired
+func ProcessDataExports(cfg *config.Config, m mailer.Mailer) error {
+	if err := database.DB.Model(&models.DataExport{}).
+		Where("status = ? AND updated_at < ?", models.DataExportProcessing, time.Now().Add(-staleExportAfter)).
+		Update("status", models.DataExportPending).Error; err != nil {
+		return err
+	}
+
+	var exports []models.DataExport
+	if err := database.DB.Where("status = ?", models.DataExportPending).
+		Order("created_at ASC").
+		Find(&exports).Error; err != nil {
+		return err
+	}
+
+	for i := range exports {
+		// Only one instance may build an export
+		result := database.DB.Model(&exports[i]).
+			Where("status = ?", models.DataExportPending).
+			Update("status", models.DataExportProcessing)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := completeDataExport(cfg, m, &exports[i]); err != nil {
+			log.Printf("Failed to build data export %d: %v", exports[i].ID, err)
+			database.DB.Model(&exports[i]).Update("status", models.DataExportFailed)
+		}
+	}
+
+	return expireDataExports()
+}
+
+// completeDataExport builds the archive, marks the export ready and emails
+// the user a download link
+func completeDataExport(cfg *config.Config, m mailer.Mailer, export *models.DataExport) error {
+	var user models.User
+	if err := database.DB.First(&user, export.UserID).Error; err != nil {
+		return err
+	}
+
+	filePath, size, err := buildDataExport(cfg, &user, export.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(exportTokenBytes)
+	if err != nil {
+		os.Remove(filePath)
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(cfg.ExportTTL)
+	if err := database.DB.Model(export).Updates(map[string]interface{}{
+		"status":       models.DataExportReady,
+		"file_path":    filePath,
+		"size":         size,
+		"token_hash":   utils.HashToken(token),
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		os.Remove(filePath)
+		return err
+	}
+
+	link := fmt.Sprintf("%s/data-export?token=%s", cfg.AppURL, url.QueryEscape(token))
+	if err := m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("Hi %s,\n\nThe copy of your %s data you asked for is ready. Download it with the link below; it expires in %s.\n\n%s\n",
+			user.FirstName, cfg.AppName, cfg.ExportTTL, link),
+	}); err != nil {
+		log.Printf("Failed to send email to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// expireDataExports removes the archives of exports whose link has expired
+func expireDataExports() error {
+	var exports []models.DataExport
+	if err := database.DB.Where("status = ? AND expires_at < ?", models.DataExportReady, time.Now()).
+		Find(&exports).Error; err != nil {
+		return err
+	}
+
+	for i := range exports {
+		removeExportFile(exports[i].FilePath)
+		if err := database.DB.Model(&exports[i]).Updates(map[string]interface{}{
+			"status":     models.DataExportExpired,
+			"file_path":  "",
+			"token_hash": "",
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeExportFile(filePath string) {
+	if filePath == "" {
+		return
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove data export %s: %v", filePath, err)
+	}
+}
+
+// exportFile describes one file of the archive in manifest.json
+type exportFile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Count       int    `json:"count,omitempty"`
+}
+
+type exportManifest struct {
+	UserID      uint         `json:"user_id"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Files       []exportFile `json:"files"`
+}
+
+type exportProfile struct {
+	ID               uint       `json:"id"`
+	Handle           string     `json:"handle"`
+	FirstName        string     `json:"first_name"`
+	LastName         string     `json:"last_name"`
+	Email            string     `json:"email"`
+	Bio              string     `json:"bio"`
+	AvatarURL        string     `json:"avatar_url,omitempty"`
+	Avatar           string     `json:"avatar,omitempty"` // path of the avatar in the archive
+	Location         string     `json:"location"`
+	Website          string     `json:"website"`
+	Role             string     `json:"role"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Identities   []exportIdentity                     `json:"identities"`
+	Passkeys     []exportPasskey                      `json:"passkeys"`
+	Sessions     []models.SessionResponse             `json:"sessions"`
+	AccessTokens []models.PersonalAccessTokenResponse `json:"access_tokens"`
+}
+
+type exportIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportPasskey struct {
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type exportPost struct {
+	ID         uint       `json:"id"`
+	Content    string     `json:"content"`
+	ImageURL   string     `json:"image_url,omitempty"`
+	Image      string     `json:"image,omitempty"` // path of the image in the archive
+	Visibility string     `json:"visibility"`
+	HiddenAt   *time.Time `json:"hidden_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+type exportComment struct {
+	ID              uint       `json:"id"`
+	PostID          uint       `json:"post_id"`
+	ParentCommentID *uint      `json:"parent_comment_id,omitempty"`
+	Content         string     `json:"content"`
+	HiddenAt        *time.Time `json:"hidden_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// exportFollow is a user the exporting user follows, blocked, muted or
+// counts as a close friend
+type exportFollow struct {
+	UserID    uint      `json:"user_id"`
+	Handle    string    `json:"handle"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportLike struct {
+	LikeableType string    `json:"likeable_type"`
+	LikeableID   uint      `json:"likeable_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// buildDataExport writes a zip archive of everything stored about the user
+// and returns its path and size. Deleted posts and comments are included
+// since they are still stored.
+func buildDataExport(cfg *config.Config, user *models.User, exportID uint) (string, int64, error) {
+	if err := os.MkdirAll(cfg.ExportDir, 0700); err != nil {
+		return "", 0, err
+	}
+
+	filePath := filepath.Join(cfg.ExportDir, fmt.Sprintf("export-%d.zip", exportID))
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = writeDataExport(zip.NewWriter(file), cfg, user)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return "", 0, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	return filePath, info.Size(), nil
+}
+
+func writeDataExport(archive *zip.Writer, cfg *config.Config, user *models.User) error {
+	profile, err := loadExportProfile(user)
+	if err != nil {
+		return err
+	}
+
+	var posts []models.Post
+	if err := database.DB.Unscoped().Where("user_id = ?", user.ID).Order("created_at ASC").Find(&posts).Error; err != nil {
+		return err
+	}
+	var comments []models.Comment
+	if err := database.DB.Unscoped().Where("user_id = ?", user.ID).Order("created_at ASC").Find(&comments).Error; err != nil {
+		return err
+	}
+	var likes []models.Like
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&likes).Error; err != nil {
+		return err
+	}
+	var follows []models.Follow
+	if err := database.DB.Preload("Followee").Where("follower_id = ?", user.ID).Order("created_at ASC").Find(&follows).Error; err != nil {
+		return err
+	}
+	blocked, err := exportRelated(user.ID, "blocks", "blocker_id", "blocked_id")
+	if err != nil {
+		return err
+	}
+	muted, err := exportRelated(user.ID, "mutes", "muter_id", "muted_id")
+	if err != nil {
+		return err
+	}
+	closeFriends, err := exportRelated(user.ID, "close_friends", "user_id", "friend_id")
+	if err != nil {
+		return err
+	}
+	var uploads []models.Upload
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&uploads).Error; err != nil {
+		return err
+	}
+
+	// Only the user's own uploads are copied. Image URLs on posts and
+	// profiles are supplied by clients and may point at another user's file.
+	images := make(map[string]string, len(uploads)) // upload URL to name in the archive
+	imageFiles := []exportFile{}
+	for _, u := range uploads {
+		name, err := writeExportImage(archive, cfg.UploadDir, u.URL)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		images[u.URL] = name
+		imageFiles = append(imageFiles, exportFile{
+			Name:        name,
+			Description: "Image uploaded at " + u.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	profile.Avatar = images[user.AvatarURL]
+
+	exportPosts := make([]exportPost, len(posts))
+	for i, p := range posts {
+		exportPosts[i] = exportPost{
+			ID:         p.ID,
+			Content:    p.Content,
+			ImageURL:   p.ImageURL,
+			Image:      images[p.ImageURL],
+			Visibility: p.Visibility,
+			HiddenAt:   p.HiddenAt,
+			CreatedAt:  p.CreatedAt,
+			UpdatedAt:  p.UpdatedAt,
+			DeletedAt:  deletedAt(p.DeletedAt),
+		}
+	}
+
+	exportComments := make([]exportComment, len(comments))
+	for i, c := range comments {
+		exportComments[i] = exportComment{
+			ID:              c.ID,
+			PostID:          c.PostID,
+			ParentCommentID: c.ParentCommentID,
+			Content:         c.Content,
+			HiddenAt:        c.HiddenAt,
+			CreatedAt:       c.CreatedAt,
+			UpdatedAt:       c.UpdatedAt,
+			DeletedAt:       deletedAt(c.DeletedAt),
+		}
+	}
+
+	exportLikes := make([]exportLike, len(likes))
+	for i, l := range likes {
+		exportLikes[i] = exportLike{
+			LikeableType: l.LikeableType,
+			LikeableID:   l.LikeableID,
+			CreatedAt:    l.CreatedAt,
+		}
+	}
+
+	exportFollows := make([]exportFollow, len(follows))
+	for i, f := range follows {
+		exportFollows[i] = exportFollow{
+			UserID:    f.FolloweeID,
+			Handle:    f.Followee.Handle,
+			CreatedAt: f.CreatedAt,
+		}
+	}
+
+	manifest := exportManifest{
+		UserID:      user.ID,
+		GeneratedAt: time.Now(),
+		Files: []exportFile{
+			{Name: "profile.json", Description: "Profile and account details, linked logins, passkeys, sessions and access tokens"},
+			{Name: "posts.json", Description: "Posts, including deleted ones", Count: len(exportPosts)},
+			{Name: "comments.json", Description: "Comments and replies, including deleted ones", Count: len(exportComments)},
+			{Name: "likes.json", Description: "Likes on posts and comments", Count: len(exportLikes)},
+			{Name: "following.json", Description: "Accounts followed", Count: len(exportFollows)},
+			{Name: "blocked.json", Description: "Accounts blocked", Count: len(blocked)},
+			{Name: "muted.json", Description: "Accounts muted", Count: len(muted)},
+			{Name: "close_friends.json", Description: "Close friends list", Count: len(closeFriends)},
+		},
+	}
+	manifest.Files = append(manifest.Files, imageFiles...)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"manifest.json", manifest},
+		{"profile.json", profile},
+		{"posts.json", exportPosts},
+		{"comments.json", exportComments},
+		{"likes.json", exportLikes},
+		{"following.json", exportFollows},
+		{"blocked.json", blocked},
+		{"muted.json", muted},
+		{"close_friends.json", closeFriends},
+	}
+	for _, f := range files {
+		if err := writeExportJSON(archive, f.name, f.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func loadExportProfile(user *models.User) (*exportProfile, error) {
+	profile := &exportProfile{
+		ID:               user.ID,
+		Handle:           user.Handle,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Email:            user.Email,
+		Bio:              user.Bio,
+		AvatarURL:        user.AvatarURL,
+		Location:         user.Location,
+		Website:          user.Website,
+		Role:             user.Role,
+		EmailVerifiedAt:  user.EmailVerifiedAt,
+		TwoFactorEnabled: user.HasTwoFactor(),
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	profile.Identities = make([]exportIdentity, len(identities))
+	for i, identity := range identities {
+		profile.Identities[i] = exportIdentity{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		}
+	}
+
+	var passkeys []models.Passkey
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	profile.Passkeys = make([]exportPasskey, len(passkeys))
+	for i, passkey := range passkeys {
+		profile.Passkeys[i] = exportPasskey{
+			Name:       passkey.Name,
+			LastUsedAt: passkey.LastUsedAt,
+			CreatedAt:  passkey.CreatedAt,
+		}
+	}
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	profile.Sessions = make([]models.SessionResponse, len(sessions))
+	for i := range sessions {
+		profile.Sessions[i] = sessions[i].ToResponse(0)
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	profile.AccessTokens = make([]models.PersonalAccessTokenResponse, len(tokens))
+	for i := range tokens {
+		profile.AccessTokens[i] = tokens[i].ToResponse()
+	}
+
+	return profile, nil
+}
+
+// exportRelated lists the users in the other column of the rows of table
+// whose by column is the exporting user
+func exportRelated(userID uint, table, by, other string) ([]exportFollow, error) {
+	related := []exportFollow{}
+	err := database.DB.Table(table).
+		Select("users.id AS user_id, users.handle, "+table+".created_at").
+		Joins("JOIN users ON users.id = "+table+"."+other).
+		Where(table+"."+by+" = ?", userID).
+		Order(table + ".created_at ASC").
+		Scan(&related).Error
+	return related, err
+}
+
+func writeExportJSON(archive *zip.Writer, name string, data interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// writeExportImage copies an uploaded image into the archive and returns its
+// name there. Missing files are skipped.
+func writeExportImage(archive *zip.Writer, uploadDir, imageURL string) (string, error) {
+	filePath, ok := utils.UploadPath(uploadDir, imageURL)
+	if !ok {
+		return "", nil
+	}
+
+	src, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	name := "images/" + filepath.Base(filePath)
+	w, err := archive.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func deletedAt(d gorm.DeletedAt) *time.Time {
+	if !d.Valid {
+		return nil
+	}
+	return &d.Time
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/testdb"
+)
+
+// readExport builds the user's archive in memory and returns its files
+func readExport(t *testing.T, cfg *config.Config, user *models.User) map[string][]byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := writeDataExport(zip.NewWriter(&buf), cfg, user); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		if _, ok := files[f.Name]; ok {
+			t.Errorf("%s is in the archive twice", f.Name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = data
+	}
+	return files
+}
+
+func unmarshal(t *testing.T, files map[string][]byte, name string, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(files[name], v); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestDataExportImages(t *testing.T) {
+	testdb.Open(t)
+	cfg := &config.Config{UploadDir: t.TempDir()}
+
+	alice := createUser(t, "alice")
+	bob := createUser(t, "bob")
+
+	avatar := upload(t, cfg.UploadDir, alice, "avatar.png")
+	attached := upload(t, cfg.UploadDir, alice, "attached.png")
+	upload(t, cfg.UploadDir, alice, "unused.png")
+	bobImage := upload(t, cfg.UploadDir, bob, "bob.png")
+	// An upload whose file is gone is skipped
+	database.DB.Create(&models.Upload{UserID: alice.ID, URL: "/uploads/missing.png"})
+
+	database.DB.Model(alice).Update("avatar_url", avatar)
+	alice.AvatarURL = avatar
+	for _, imageURL := range []string{attached, attached, bobImage} {
+		if err := database.DB.Create(&models.Post{UserID: alice.ID, Content: "Post", ImageURL: imageURL}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := readExport(t, cfg, alice)
+
+	wantImages := []string{"images/avatar.png", "images/attached.png", "images/unused.png"}
+	for _, name := range wantImages {
+		if string(files[name]) != "image" {
+			t.Errorf("%s = %q, want the uploaded file", name, files[name])
+		}
+	}
+	for _, name := range []string{"images/bob.png", "images/missing.png"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("archive contains %s", name)
+		}
+	}
+
+	var manifest exportManifest
+	unmarshal(t, files, "manifest.json", &manifest)
+	listed := map[string]bool{}
+	for _, f := range manifest.Files {
+		listed[f.Name] = true
+		if _, ok := files[f.Name]; !ok {
+			t.Errorf("manifest lists %s, which isn't in the archive", f.Name)
+		}
+	}
+	for _, name := range wantImages {
+		if !listed[name] {
+			t.Errorf("manifest doesn't list %s", name)
+		}
+	}
+
+	var profile exportProfile
+	unmarshal(t, files, "profile.json", &profile)
+	if profile.Avatar != "images/avatar.png" {
+		t.Errorf("profile avatar = %q, want images/avatar.png", profile.Avatar)
+	}
+
+	var posts []exportPost
+	unmarshal(t, files, "posts.json", &posts)
+	for i, want := range []string{"images/attached.png", "images/attached.png", ""} {
+		if posts[i].Image != want {
+			t.Errorf("post %d image = %q, want %q", i, posts[i].Image, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Package jobs holds background work that runs alongside the API server
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn in the background right away and then once per interval
+func Every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := fn(); err != nil {
+				log.Printf("Job %s failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogMailer writes emails to the log and, when Dir is set, stores each one
+// as an .eml file. Useful in development and tests.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+// Send logs the message and writes it to Dir
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	filename := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102150405"), uuid.New().String())
+	if err := os.WriteFile(filepath.Join(m.Dir, filename), format(m.From, msg), 0644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
@@ -1,15 +1,18 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
+	"github.com/applifylab/social-feed-backend/internal/auth"
 	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/models"
 	"github.com/applifylab/social-feed-backend/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT token and sets user context
+// AuthMiddleware validates a JWT or personal access token and sets user context
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -28,20 +31,161 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		}
 
 		token := parts[1]
-		claims, err := utils.ValidateToken(token, cfg.JWTSecret)
-		if err != nil {
+
+		// Personal access tokens carry their own scopes
+		if strings.HasPrefix(token, models.AccessTokenPrefix) {
+			pat, err := auth.AuthenticateAccessToken(token)
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized", "Invalid or expired token")
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", pat.UserID)
+			c.Set("user_email", pat.User.Email)
+			c.Set("role", pat.User.Role)
+			c.Set("scopes", pat.ScopeList())
+			c.Next()
+			return
+		}
+
+		claims, err := utils.ValidateToken(token, auth.Keys)
+		if err != nil || claims.Purpose != "" {
 			utils.ErrorResponse(c, http.StatusUnauthorized, "unauthorized", "Invalid or expired token")
 			c.Abort()
 			return
 		}
 
+		// Reject tokens that were logged out individually
+		if auth.IsTokenRevoked(claims.ID) {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "token_revoked", "Token has been revoked")
+			c.Abort()
+			return
+		}
+
+		// Reject tokens whose session was signed out
+		if claims.SessionID != 0 {
+			revoked, err := auth.IsSessionRevoked(claims.SessionID)
+			if err != nil || revoked {
+				utils.ErrorResponse(c, http.StatusUnauthorized, "token_revoked", "Token has been revoked")
+				c.Abort()
+				return
+			}
+		}
+
+		// Reject tokens issued before the user logged out everywhere
+		version, err := auth.TokenVersion(claims.UserID)
+		if err != nil || version != claims.TokenVersion {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "token_revoked", "Token has been revoked")
+			c.Abort()
+			return
+		}
+
 		// Set user ID in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Set("role", claims.Role)
+		c.Set("claims", claims)
+
+		if claims.ImpersonatorID != 0 {
+			impersonate(c, claims)
+			return
+		}
+		c.Next()
+	}
+}
+
+// impersonate runs a request made by an admin acting as another user. Every
+// such request is audited, including the ones that are refused.
+func impersonate(c *gin.Context, claims *utils.Claims) {
+	c.Set("impersonator_id", claims.ImpersonatorID)
+
+	if auth.ImpersonationAllows(claims, c.Request.Method) {
+		c.Next()
+	} else {
+		utils.ErrorResponse(c, http.StatusForbidden, "impersonation_read_only", "This action is not allowed while impersonating a user")
+		c.Abort()
+	}
+
+	entry := models.ImpersonatedRequest{
+		TokenID:   claims.ID,
+		AdminID:   claims.ImpersonatorID,
+		UserID:    claims.UserID,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.RequestURI(),
+		Status:    c.Writer.Status(),
+		IPAddress: c.ClientIP(),
+	}
+	if len(entry.Path) > 500 {
+		entry.Path = entry.Path[:500]
+	}
+	if err := auth.AuditImpersonatedRequest(entry); err != nil {
+		log.Printf("Failed to audit impersonated request: %v", err)
+	}
+}
+
+// DenyImpersonatedWrites refuses changes made with an impersonation token,
+// even one that allows writes. Used for the account routes, so an admin can't
+// change the user's credentials.
+func DenyImpersonatedWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonator_id"); impersonating && c.Request.Method != http.MethodGet {
+			utils.ErrorResponse(c, http.StatusForbidden, "impersonation_read_only", "This action is not allowed while impersonating a user")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission only lets users whose role grants perm through. Must
+// run after AuthMiddleware.
+func RequirePermission(perm auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			utils.ErrorResponse(c, http.StatusForbidden, "forbidden", "You don't have permission to do this")
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
+// HasPermission reports whether the current user's role grants perm
+func HasPermission(c *gin.Context, perm auth.Permission) bool {
+	return auth.HasPermission(GetRole(c), perm)
+}
+
+// RequireScope limits personal access tokens to the routes their scopes
+// allow: GET requests need "<resource>:read", everything else
+// "<resource>:write". Session tokens have full access.
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, exists := c.Get("scopes")
+		if !exists {
+			c.Next()
+			return
+		}
+
+		required := resource + ":write"
+		if c.Request.Method == http.MethodGet {
+			required = resource + ":read"
+		}
+
+		for _, scope := range scopes.([]string) {
+			if scope == required {
+				c.Next()
+				return
+			}
+		}
+
+		utils.ErrorResponse(c, http.StatusForbidden, "insufficient_scope", "Token is missing the "+required+" scope")
+		c.Abort()
+	}
+}
+
 // GetUserID retrieves user ID from context
 func GetUserID(c *gin.Context) (uint, bool) {
 	userID, exists := c.Get("user_id")
@@ -50,3 +194,17 @@ func GetUserID(c *gin.Context) (uint, bool) {
 	}
 	return userID.(uint), true
 }
+
+// GetRole retrieves the current user's role from context
+func GetRole(c *gin.Context) string {
+	return c.GetString("role")
+}
+
+// GetClaims retrieves the validated token claims from context
+func GetClaims(c *gin.Context) (*utils.Claims, bool) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+	return claims.(*utils.Claims), true
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail restricts users who haven't confirmed their email
+// according to cfg.UnverifiedUserPolicy. Must run after AuthMiddleware.
+func RequireVerifiedEmail(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch cfg.UnverifiedUserPolicy {
+		case config.PolicyAllow:
+			c.Next()
+			return
+		case config.PolicyBlock:
+		default:
+			// Read only: reads are always allowed
+			if c.Request.Method == http.MethodGet {
+				c.Next()
+				return
+			}
+		}
+
+		// Verification is never undone, so a verified token needs no lookup
+		claims, exists := GetClaims(c)
+		if exists && claims.EmailVerified {
+			c.Next()
+			return
+		}
+
+		userID, _ := GetUserID(c)
+		var user models.User
+		if err := database.DB.Select("id", "email_verified_at").First(&user, userID).Error; err != nil || !user.IsEmailVerified() {
+			utils.ErrorResponse(c, http.StatusForbidden, "email_not_verified", "Please verify your email address first")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
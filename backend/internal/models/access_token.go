@@ -0,0 +1,84 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix starts every personal access token so it can be told
+// apart from a JWT
+const AccessTokenPrefix = "sfp_"
+
+// TokenScopes lists the scopes a personal access token can be granted. The
+// part before the colon is the route group, e.g. "posts" for /api/posts.
+var TokenScopes = []string{
+	"account:read",
+	"users:read",
+	"users:write",
+	"posts:read",
+	"posts:write",
+	"comments:read",
+	"comments:write",
+	"uploads:write",
+}
+
+// PersonalAccessToken lets scripts call the API on behalf of a user. Only
+// the SHA-256 hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Hint       string     `gorm:"size:20;not null" json:"hint"` // first characters, to recognise the token
+	Scopes     string     `gorm:"size:500;not null" json:"-"`   // space separated
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// PersonalAccessTokenResponse is the public representation of a token
+type PersonalAccessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the token's scopes
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// IsExpired reports whether the token has passed its expiry date
+func (t *PersonalAccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// ToResponse converts PersonalAccessToken to PersonalAccessTokenResponse
+func (t *PersonalAccessToken) ToResponse() PersonalAccessTokenResponse {
+	return PersonalAccessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Hint:       t.Hint,
+		Scopes:     t.ScopeList(),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+// IsValidTokenScope reports whether scope can be granted to a token
+func IsValidTokenScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
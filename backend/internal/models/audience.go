@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// PostAudience lets a user see a post whose visibility is "specific"
+type PostAudience struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PostID    uint      `gorm:"not null;uniqueIndex:idx_post_audience" json:"post_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_post_audience;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CloseFriend puts a user on another user's close friends list, who then
+// sees that user's "close_friends" posts
+type CloseFriend struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_close_friend" json:"user_id"`
+	FriendID  uint      `gorm:"not null;uniqueIndex:idx_close_friend;index" json:"friend_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
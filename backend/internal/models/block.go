@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Block records that one user blocked another. Neither sees the other's
+// posts, comments or likes and neither can interact with the other.
+type Block struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BlockerID uint      `gorm:"not null;uniqueIndex:idx_blocker_blocked" json:"blocker_id"`
+	BlockedID uint      `gorm:"not null;uniqueIndex:idx_blocker_blocked;index" json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Mute records that one user muted another. The muted user's posts are left
+// out of the muter's feeds; the muted user isn't told and isn't restricted.
+type Mute struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MuterID   uint      `gorm:"not null;uniqueIndex:idx_muter_muted" json:"muter_id"`
+	MutedID   uint      `gorm:"not null;uniqueIndex:idx_muter_muted;index" json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
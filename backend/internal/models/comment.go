@@ -12,6 +12,9 @@ type Comment struct {
 	UserID          uint           `gorm:"not null;index" json:"user_id"`
 	ParentCommentID *uint          `gorm:"index" json:"parent_comment_id,omitempty"`
 	Content         string         `gorm:"type:text;not null" json:"content"`
+	HiddenAt        *time.Time     `gorm:"index" json:"hidden_at,omitempty"`
+	LikesCount      int64          `gorm:"not null;default:0" json:"likes_count"`   // kept by the counters package
+	RepliesCount    int64          `gorm:"not null;default:0" json:"replies_count"` // kept by the counters package
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
@@ -24,9 +27,7 @@ type Comment struct {
 	Likes    []Like    `gorm:"polymorphic:Likeable;polymorphicValue:comment" json:"likes,omitempty"`
 
 	// Computed fields
-	LikesCount   int64 `gorm:"-" json:"likes_count"`
-	RepliesCount int64 `gorm:"-" json:"replies_count"`
-	IsLiked      bool  `gorm:"-" json:"is_liked"`
+	IsLiked bool `gorm:"-" json:"is_liked"`
 }
 
 // CommentResponse is the public representation of a comment
@@ -35,6 +36,7 @@ type CommentResponse struct {
 	PostID          uint         `json:"post_id"`
 	ParentCommentID *uint        `json:"parent_comment_id,omitempty"`
 	Content         string       `json:"content"`
+	HiddenAt        *time.Time   `json:"hidden_at,omitempty"`
 	CreatedAt       time.Time    `json:"created_at"`
 	UpdatedAt       time.Time    `json:"updated_at"`
 	User            UserResponse `json:"user"`
@@ -50,6 +52,7 @@ func (c *Comment) ToResponse() CommentResponse {
 		PostID:          c.PostID,
 		ParentCommentID: c.ParentCommentID,
 		Content:         c.Content,
+		HiddenAt:        c.HiddenAt,
 		CreatedAt:       c.CreatedAt,
 		UpdatedAt:       c.UpdatedAt,
 		User:            c.User.ToResponse(),
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// States of a data export
+const (
+	DataExportPending    = "pending"
+	DataExportProcessing = "processing"
+	DataExportReady      = "ready"
+	DataExportFailed     = "failed"
+	DataExportExpired    = "expired"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is
+// built in the background and can be downloaded with the emailed link until
+// ExpiresAt. Only the SHA-256 hash of the download token is stored.
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	FilePath    string     `gorm:"size:500" json:"-"`
+	Size        int64      `gorm:"not null;default:0" json:"size"`
+	TokenHash   string     `gorm:"size:64;index" json:"-"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Follow records that one user follows another
+type Follow struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	FollowerID uint      `gorm:"not null;uniqueIndex:idx_follower_followee" json:"follower_id"`
+	FolloweeID uint      `gorm:"not null;uniqueIndex:idx_follower_followee;index" json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relationships
+	Follower User `gorm:"foreignKey:FollowerID" json:"-"`
+	Followee User `gorm:"foreignKey:FolloweeID" json:"-"`
+}
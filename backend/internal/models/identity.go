@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:50;not null;uniqueIndex:idx_provider_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_provider_subject" json:"-"`
+	Email     string    `gorm:"size:255" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// UserIdentityResponse describes a linked account for the linked accounts list
+type UserIdentityResponse struct {
+	ID        uint      `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToResponse converts UserIdentity to UserIdentityResponse
+func (i *UserIdentity) ToResponse() UserIdentityResponse {
+	return UserIdentityResponse{
+		ID:        i.ID,
+		Provider:  i.Provider,
+		Email:     i.Email,
+		CreatedAt: i.CreatedAt,
+	}
+}
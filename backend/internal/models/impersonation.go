@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Impersonation records an admin starting to act as another user, e.g. to
+// debug a report. TokenID is the jti of the token that was issued.
+type Impersonation struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	AdminID     uint       `gorm:"not null;index" json:"admin_id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Reason      string     `gorm:"size:500;not null" json:"reason"`
+	AllowWrites bool       `gorm:"not null;default:false" json:"allow_writes"`
+	TokenID     string     `gorm:"size:36;uniqueIndex;not null" json:"token_id"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+}
+
+// ImpersonatedRequest is an audit record of a request made with an
+// impersonation token, including the ones that were refused
+type ImpersonatedRequest struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TokenID   string    `gorm:"size:36;not null;index" json:"token_id"`
+	AdminID   uint      `gorm:"not null;index" json:"admin_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Method    string    `gorm:"size:10;not null" json:"method"`
+	Path      string    `gorm:"size:500;not null" json:"path"`
+	Status    int       `gorm:"not null" json:"status"`
+	IPAddress string    `gorm:"size:45;not null" json:"ip_address"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
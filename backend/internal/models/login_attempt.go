@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Reasons a login attempt failed
+const (
+	LoginFailureInvalidPassword = "invalid_password"
+	LoginFailureUnknownEmail    = "unknown_email"
+	LoginFailureInvalidCode     = "invalid_2fa_code"
+	LoginFailureInvalidLink     = "invalid_magic_link"
+	LoginFailureLocked          = "locked"
+	LoginFailureThrottled       = "throttled"
+)
+
+// FailedLogin is an audit record of a rejected login attempt
+type FailedLogin struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"size:255;not null;index" json:"email"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	IPAddress string    `gorm:"size:45;not null;index" json:"ip_address"`
+	UserAgent string    `gorm:"size:500" json:"user_agent"`
+	Reason    string    `gorm:"size:50;not null" json:"reason"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// LoginThrottle counts recent failed logins for an account or IP address
+// and how long further attempts are locked out
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey;size:300" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
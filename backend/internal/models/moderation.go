@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Moderation actions
+const (
+	ModerationActionDelete = "delete"
+	ModerationActionHide   = "hide"
+	ModerationActionUnhide = "unhide"
+)
+
+// Moderation targets
+const (
+	ModerationTargetPost    = "post"
+	ModerationTargetComment = "comment"
+)
+
+// ModerationAction records a moderator acting on someone else's content
+type ModerationAction struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ModeratorID uint      `gorm:"not null;index" json:"moderator_id"`
+	Action      string    `gorm:"size:20;not null" json:"action"`
+	TargetType  string    `gorm:"size:20;not null;index:idx_moderation_target" json:"target_type"`
+	TargetID    uint      `gorm:"not null;index:idx_moderation_target" json:"target_id"`
+	TargetOwner uint      `gorm:"not null;index" json:"target_owner_id"`
+	Reason      string    `gorm:"size:500" json:"reason,omitempty"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+
+	Moderator User `gorm:"foreignKey:ModeratorID" json:"-"`
+}
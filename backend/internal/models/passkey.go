@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// Passkey ceremonies
+const (
+	PasskeyCeremonyRegistration = "registration"
+	PasskeyCeremonyLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential the user can sign in with instead of a
+// password
+type Passkey struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"not null;index" json:"-"`
+	Name            string     `gorm:"size:100;not null" json:"name"`
+	CredentialID    []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	PublicKey       []byte     `gorm:"not null" json:"-"`
+	AttestationType string     `gorm:"size:32" json:"-"`
+	Transports      string     `gorm:"size:200" json:"-"` // comma separated
+	AAGUID          []byte     `gorm:"column:aaguid" json:"-"`
+	SignCount       int64      `gorm:"not null;default:0" json:"sign_count"`
+	CloneWarning    bool       `gorm:"not null;default:false" json:"clone_warning"`
+	BackupEligible  bool       `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState     bool       `gorm:"not null;default:false" json:"backup_state"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// PasskeyChallenge keeps the server side state of a WebAuthn ceremony
+// between its begin and finish steps. Only the SHA-256 hash of the
+// challenge ID handed to the client is stored.
+type PasskeyChallenge struct {
+	ID        uint      `gorm:"primaryKey"`
+	TokenHash string    `gorm:"size:64;uniqueIndex;not null"`
+	Ceremony  string    `gorm:"size:20;not null"`
+	UserID    *uint     `gorm:"index"`              // unset for discoverable logins
+	Data      string    `gorm:"type:text;not null"` // JSON encoded webauthn.SessionData
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -6,15 +6,37 @@ import (
 	"gorm.io/gorm"
 )
 
+// Who can see a post. The author always can.
+const (
+	VisibilityPublic       = "public"
+	VisibilityFollowers    = "followers"
+	VisibilityCloseFriends = "close_friends" // the author's close friends list
+	VisibilityOnlyMe       = "only_me"
+	VisibilitySpecific     = "specific" // the users in the post's audience
+)
+
+// IsValidVisibility reports whether visibility is a known visibility
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityFollowers, VisibilityCloseFriends, VisibilityOnlyMe, VisibilitySpecific:
+		return true
+	}
+	return false
+}
+
 type Post struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	UserID    uint           `gorm:"not null;index" json:"user_id"`
-	Content   string         `gorm:"type:text;not null" json:"content"`
-	ImageURL  string         `gorm:"size:500" json:"image_url,omitempty"`
-	IsPrivate bool           `gorm:"default:false" json:"is_private"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primaryKey;index:idx_posts_created,priority:2" json:"id"`
+	UserID        uint           `gorm:"not null;index;index:idx_posts_pull,priority:1,where:fanned_out = false" json:"user_id"`
+	Content       string         `gorm:"type:text;not null" json:"content"`
+	ImageURL      string         `gorm:"size:500" json:"image_url,omitempty"`
+	Visibility    string         `gorm:"size:20;not null;default:public" json:"visibility"`
+	HiddenAt      *time.Time     `gorm:"index" json:"hidden_at,omitempty"`
+	FannedOut     bool           `gorm:"not null;default:false" json:"-"`          // written to the followers' timelines
+	LikesCount    int64          `gorm:"not null;default:0" json:"likes_count"`    // kept by the counters package
+	CommentsCount int64          `gorm:"not null;default:0" json:"comments_count"` // kept by the counters package
+	CreatedAt     time.Time      `gorm:"index:idx_posts_pull,priority:2;index:idx_posts_created,priority:1" json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	User     User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -22,9 +44,7 @@ type Post struct {
 	Likes    []Like    `gorm:"polymorphic:Likeable;polymorphicValue:post" json:"likes,omitempty"`
 
 	// Computed fields
-	LikesCount    int64 `gorm:"-" json:"likes_count"`
-	CommentsCount int64 `gorm:"-" json:"comments_count"`
-	IsLiked       bool  `gorm:"-" json:"is_liked"`
+	IsLiked bool `gorm:"-" json:"is_liked"`
 }
 
 // PostResponse is the public representation of a post
@@ -32,7 +52,8 @@ type PostResponse struct {
 	ID            uint         `json:"id"`
 	Content       string       `json:"content"`
 	ImageURL      string       `json:"image_url,omitempty"`
-	IsPrivate     bool         `json:"is_private"`
+	Visibility    string       `json:"visibility"`
+	HiddenAt      *time.Time   `json:"hidden_at,omitempty"`
 	CreatedAt     time.Time    `json:"created_at"`
 	UpdatedAt     time.Time    `json:"updated_at"`
 	User          UserResponse `json:"user"`
@@ -47,7 +68,8 @@ func (p *Post) ToResponse() PostResponse {
 		ID:            p.ID,
 		Content:       p.Content,
 		ImageURL:      p.ImageURL,
-		IsPrivate:     p.IsPrivate,
+		Visibility:    p.Visibility,
+		HiddenAt:      p.HiddenAt,
 		CreatedAt:     p.CreatedAt,
 		UpdatedAt:     p.UpdatedAt,
 		User:          p.User.ToResponse(),
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a single login of a user. Every refresh token issued for the
+// login belongs to the same session, so the session doubles as the token family.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	UserAgent  string     `gorm:"size:500" json:"user_agent"`
+	IPAddress  string     `gorm:"size:45" json:"ip_address"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relationships
+	User          User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	RefreshTokens []RefreshToken `gorm:"foreignKey:SessionID" json:"refresh_tokens,omitempty"`
+}
+
+// SessionResponse describes a login for the sessions list
+type SessionResponse struct {
+	ID         uint       `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// IsActive reports whether the session can still be used to refresh tokens
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// ToResponse converts Session to SessionResponse. currentID is the session
+// of the requesting token.
+func (s *Session) ToResponse(currentID uint) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    s.ID == currentID,
+	}
+}
+
+// RefreshToken is a single-use refresh token. Only the SHA-256 hash of the
+// token is stored; UsedAt is set once the token has been rotated.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SessionID uint       `gorm:"not null;index" json:"session_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RevokedToken is an access token that was logged out before it expired
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:36" json:"jti"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// TimelineEntry puts a post on a user's home timeline. Entries are written
+// when the post is created (fan-out on write); CreatedAt is the post's
+// creation time so a timeline can be read in order from this table alone.
+type TimelineEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_timeline_user_post;index:idx_timeline_home,priority:1" json:"user_id"`
+	PostID    uint      `gorm:"not null;uniqueIndex:idx_timeline_user_post;index;index:idx_timeline_home,priority:3,sort:desc" json:"post_id"`
+	AuthorID  uint      `gorm:"not null;index" json:"author_id"`
+	CreatedAt time.Time `gorm:"not null;index:idx_timeline_home,priority:2,sort:desc" json:"created_at"`
+}
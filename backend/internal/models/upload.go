@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Upload records who uploaded a file to /api/upload. Image URLs in posts and
+// profiles are supplied by clients, so only this tells whose file it is.
+type Upload struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	URL       string    `gorm:"size:500;uniqueIndex;not null" json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
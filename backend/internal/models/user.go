@@ -1,43 +1,146 @@
 package models
 
 import (
+	"regexp"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Roles a user can have
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// handlePattern is what a handle may look like. Handles are stored lowercase.
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// reservedHandles can't be taken because they clash with routes
+var reservedHandles = map[string]bool{
+	"me":      true,
+	"admin":   true,
+	"deleted": true,
+}
+
+// IsValidHandle reports whether handle can be used as a username
+func IsValidHandle(handle string) bool {
+	return handlePattern.MatchString(handle) && !reservedHandles[handle]
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	FirstName    string         `gorm:"size:100;not null" json:"first_name"`
-	LastName     string         `gorm:"size:100;not null" json:"last_name"`
-	Email        string         `gorm:"size:255;uniqueIndex;not null" json:"email"`
-	PasswordHash string         `gorm:"size:255;not null" json:"-"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	FirstName       string         `gorm:"size:100;not null" json:"first_name"`
+	LastName        string         `gorm:"size:100;not null" json:"last_name"`
+	Email           string         `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	Handle          string         `gorm:"size:30;uniqueIndex" json:"handle"`
+	Bio             string         `gorm:"size:500" json:"bio"`
+	AvatarURL       string         `gorm:"size:500" json:"avatar_url"`
+	Location        string         `gorm:"size:100" json:"location"`
+	Website         string         `gorm:"size:255" json:"website"`
+	PasswordHash    string         `gorm:"size:255;not null" json:"-"`
+	TokenVersion    int            `gorm:"not null;default:0" json:"-"`
+	Role            string         `gorm:"size:20;not null;default:user" json:"role"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	TOTPSecret      string         `gorm:"column:totp_secret;size:64" json:"-"`
+	TOTPEnabledAt   *time.Time     `gorm:"column:totp_enabled_at" json:"-"`
+	TOTPLastStep    int64          `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	WebAuthnHandle  []byte         `gorm:"column:webauthn_handle;uniqueIndex" json:"-"`
+	AnonymizedAt    *time.Time     `json:"-"` // set once a deleted account has been purged
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	Posts    []Post    `gorm:"foreignKey:UserID" json:"posts,omitempty"`
 	Comments []Comment `gorm:"foreignKey:UserID" json:"comments,omitempty"`
 	Likes    []Like    `gorm:"foreignKey:UserID" json:"likes,omitempty"`
+
+	// Computed fields
+	IsFollowing bool `gorm:"-" json:"-"` // whether the viewer follows this user
 }
 
-// UserResponse is the public representation of a user
+// UserResponse is the public representation of a user, shown to anyone
 type UserResponse struct {
-	ID        uint      `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint      `json:"id"`
+	Handle      string    `json:"handle"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	Bio         string    `json:"bio,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Website     string    `json:"website,omitempty"`
+	Role        string    `json:"role"`
+	Deleted     bool      `json:"deleted,omitempty"`
+	IsFollowing bool      `json:"is_following"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ProfileResponse is a user's profile page: the public representation plus
+// the size of their follow graph
+type ProfileResponse struct {
+	UserResponse
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
+	FollowsYou     bool  `json:"follows_you"`
+	Blocked        bool  `json:"blocked"`
+	Muted          bool  `json:"muted"`
+}
+
+// AccountResponse is the representation of a user shown to the user
+// themselves, with the private account details
+type AccountResponse struct {
+	UserResponse
+	Email            string `json:"email"`
+	EmailVerified    bool   `json:"email_verified"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
 }
 
 // ToResponse converts User to UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
+		ID:          u.ID,
+		Handle:      u.Handle,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		Location:    u.Location,
+		Website:     u.Website,
+		Role:        u.Role,
+		Deleted:     u.IsAnonymized(),
+		IsFollowing: u.IsFollowing,
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+// ToAccountResponse converts User to AccountResponse
+func (u *User) ToAccountResponse() AccountResponse {
+	return AccountResponse{
+		UserResponse:     u.ToResponse(),
+		Email:            u.Email,
+		EmailVerified:    u.IsEmailVerified(),
+		TwoFactorEnabled: u.HasTwoFactor(),
 	}
 }
+
+// HasTwoFactor reports whether the user has confirmed TOTP enrollment
+func (u *User) HasTwoFactor() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsAnonymized reports whether the user is what remains of a deleted account
+func (u *User) IsAnonymized() bool {
+	return u.AnonymizedAt != nil
+}
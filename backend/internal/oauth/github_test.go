@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestGitHubProviderExchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("code_verifier") != "verifier" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	authorized := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer gh-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("/api/user", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(githubUser{ID: 42, Login: "octocat", Name: "Mona Lisa Octocat"})
+	}))
+	mux.HandleFunc("/api/user/emails", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]githubEmail{
+			{Email: "other@example.com", Verified: true},
+			{Email: "Mona@Example.com", Primary: true, Verified: true},
+		})
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := NewGitHubProvider(srv.URL+"/api/", "client", "secret", "http://localhost/callback")
+	p.config.Endpoint = oauth2.Endpoint{TokenURL: srv.URL + "/login/oauth/access_token"}
+
+	identity, err := p.Exchange(context.Background(), "code", "verifier", "")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	want := Identity{
+		Subject:       "42",
+		Email:         "mona@example.com",
+		EmailVerified: true,
+		FirstName:     "Mona",
+		LastName:      "Lisa Octocat",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	if NewGitHubProvider("", "client", "secret", "").apiURL != GitHubAPIURL {
+		t.Error("empty API URL should default to GitHub")
+	}
+}
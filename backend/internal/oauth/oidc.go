@@ -0,0 +1,255 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider signs users in with any OpenID Connect provider. Endpoints are
+// read from the issuer's discovery document the first time they're needed,
+// signing keys whenever an ID token names a key we haven't seen.
+type OIDCProvider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+
+	mu          sync.Mutex
+	oauthConfig *oauth2.Config
+	userInfoURL string
+	jwksURL     string
+	// tokenIssuer is the issuer exactly as ID tokens spell it
+	tokenIssuer string
+	keys        map[string]interface{}
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+}
+
+type oidcUserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// NewOIDCProvider returns a provider for the given issuer
+func NewOIDCProvider(name, issuer, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		name:         name,
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+	}
+}
+
+// Name returns the provider key
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+// AuthCodeURL returns the provider's sign in URL
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, verifier, nonce string) (string, error) {
+	conf, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// Exchange redeems the code, verifies the ID token that comes with it and
+// reads the user's claims from the userinfo endpoint. The ID token has to be
+// signed by the issuer, addressed to us and carry the nonce of this login.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	conf, userInfoURL, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	var info oidcUserInfo
+	if err := getJSON(ctx, conf.Client(ctx, token), userInfoURL, &info); err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	// The userinfo response isn't signed, so it must describe the same user
+	if info.Subject != claims.Subject {
+		return nil, errors.New("user info subject does not match id_token")
+	}
+
+	identity := &Identity{
+		Subject:       info.Subject,
+		Email:         strings.ToLower(info.Email),
+		EmailVerified: info.EmailVerified != nil && *info.EmailVerified,
+		FirstName:     info.GivenName,
+		LastName:      info.FamilyName,
+	}
+	if identity.FirstName == "" {
+		identity.FirstName, identity.LastName = splitName(info.Name)
+	}
+	return identity, nil
+}
+
+// verifyIDToken checks the ID token's signature against the issuer's keys,
+// its issuer, audience, expiry and nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	p.mu.Lock()
+	issuer := p.tokenIssuer
+	p.mu.Unlock()
+
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods(idTokenAlgorithms),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("no subject")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID {
+		return nil, errors.New("not authorized for this client")
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("nonce mismatch")
+	}
+	return claims, nil
+}
+
+// signingKey returns the issuer's key with the given ID. The key set is
+// fetched again when the key is unknown, so rotated keys are picked up.
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	var set jsonWebKeySet
+	if err := getJSON(ctx, httpClient, p.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	p.keys = set.signingKeys()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key. Tokens without a key ID are only accepted
+// when the issuer has a single key.
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// discover loads and caches the issuer's endpoints
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauthConfig != nil {
+		return p.oauthConfig, p.userInfoURL, nil
+	}
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, httpClient, p.issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, "", fmt.Errorf("failed to load OpenID configuration: %w", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.issuer {
+		return nil, "", fmt.Errorf("issuer mismatch: expected %s, got %s", p.issuer, doc.Issuer)
+	}
+	if doc.UserInfoEndpoint == "" {
+		return nil, "", errors.New("provider has no userinfo endpoint")
+	}
+	if doc.JWKSURI == "" {
+		return nil, "", errors.New("provider has no jwks_uri")
+	}
+
+	p.oauthConfig = &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  p.redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  doc.AuthorizationEndpoint,
+			TokenURL: doc.TokenEndpoint,
+		},
+	}
+	p.userInfoURL = doc.UserInfoEndpoint
+	p.jwksURL = doc.JWKSURI
+	p.tokenIssuer = doc.Issuer
+	return p.oauthConfig, p.userInfoURL, nil
+}
+
+// getJSON fetches url and decodes the JSON response into v
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
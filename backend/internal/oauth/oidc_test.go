@@ -0,0 +1,81 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/oauthtest"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// signIn runs the authorization code flow against the issuer and returns the
+// identity, passing exchangeNonce to Exchange
+func signIn(t *testing.T, p *OIDCProvider, iss *oauthtest.Issuer, exchangeNonce string) (*Identity, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state", verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := iss.Authorize(t, authURL)
+	return p.Exchange(ctx, callback.Query().Get("code"), verifier, exchangeNonce)
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(claims jwt.MapClaims)
+		forge   bool
+		nonce   string
+		wantErr string
+	}{
+		{name: "valid", nonce: "nonce"},
+		{name: "nonce mismatch", nonce: "other", wantErr: "nonce mismatch"},
+		{name: "missing nonce", nonce: "nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }, wantErr: "nonce mismatch"},
+		{name: "wrong audience", nonce: "nonce", modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }, wantErr: "aud"},
+		{name: "wrong issuer", nonce: "nonce", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: "iss"},
+		{name: "expired", nonce: "nonce", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, wantErr: "expired"},
+		{name: "no expiry", nonce: "nonce", modify: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: "exp"},
+		{name: "other party", nonce: "nonce", modify: func(c jwt.MapClaims) { c["aud"] = []string{"client", "other"}; c["azp"] = "other" }, wantErr: "not authorized"},
+		{name: "forged signature", nonce: "nonce", forge: true, wantErr: "signature"},
+		{name: "subject mismatch", nonce: "nonce", modify: func(c jwt.MapClaims) { c["sub"] = "someone-else" }, wantErr: "subject does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := oauthtest.NewIssuer(t, "client")
+			iss.User = oauthtest.User{Subject: "sub-1", Email: "Jane@Example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"}
+			iss.ModifyIDToken = tt.modify
+			if tt.forge {
+				iss.SignWith = otherKey
+			}
+			p := NewOIDCProvider("test", iss.URL, "client", "secret", "http://localhost/callback")
+
+			identity, err := signIn(t, p, iss, tt.nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Identity{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true, FirstName: "Jane", LastName: "Doe"}
+			if *identity != want {
+				t.Errorf("identity = %+v, want %+v", *identity, want)
+			}
+		})
+	}
+}
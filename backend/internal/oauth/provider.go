@@ -0,0 +1,81 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/applifylab/social-feed-backend/internal/config"
+)
+
+// ErrUnknownProvider is returned for providers that aren't configured
+var ErrUnknownProvider = errors.New("unknown oauth provider")
+
+// httpClient is used for every call to an identity provider
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Identity is the account information an identity provider vouches for
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// Provider signs users in with the authorization code flow and PKCE
+type Provider interface {
+	// Name is the provider key used in URLs, e.g. "google"
+	Name() string
+	// AuthCodeURL returns the URL to send the user to. OpenID Connect
+	// providers echo the nonce back in the ID token.
+	AuthCodeURL(ctx context.Context, state, verifier, nonce string) (string, error)
+	// Exchange trades the code returned to the callback for the user's identity
+	Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error)
+}
+
+// Registry holds the configured providers by name
+type Registry map[string]Provider
+
+// Get returns the provider with the given name
+func (r Registry) Get(name string) (Provider, error) {
+	p, ok := r[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// NewRegistry builds every provider that has credentials in the config
+func NewRegistry(cfg *config.Config) Registry {
+	r := Registry{}
+	add := func(p Provider) { r[p.Name()] = p }
+
+	if cfg.GoogleClientID != "" {
+		add(NewOIDCProvider("google", "https://accounts.google.com",
+			cfg.GoogleClientID, cfg.GoogleClientSecret, callbackURL(cfg, "google")))
+	}
+	if cfg.GitHubClientID != "" {
+		add(NewGitHubProvider(cfg.GitHubAPIURL,
+			cfg.GitHubClientID, cfg.GitHubClientSecret, callbackURL(cfg, "github")))
+	}
+	if cfg.OIDCIssuer != "" && cfg.OIDCClientID != "" {
+		add(NewOIDCProvider(cfg.OIDCName, cfg.OIDCIssuer,
+			cfg.OIDCClientID, cfg.OIDCClientSecret, callbackURL(cfg, cfg.OIDCName)))
+	}
+	return r
+}
+
+// callbackURL is where a provider redirects back to after sign in
+func callbackURL(cfg *config.Config, provider string) string {
+	return fmt.Sprintf("%s/api/auth/oauth/%s/callback", strings.TrimRight(cfg.PublicURL, "/"), provider)
+}
+
+// splitName splits a display name into first and last name
+func splitName(name string) (string, string) {
+	first, last, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
+}
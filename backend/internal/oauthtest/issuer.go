@@ -0,0 +1,258 @@
+// Package oauthtest runs a fake OpenID Connect issuer for tests. It serves the
+// discovery document, authorization, token, userinfo and JWKS endpoints and
+// signs ID tokens with a throwaway RSA key.
+package oauthtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "test-key"
+
+var (
+	keyOnce    sync.Once
+	signingKey *rsa.PrivateKey
+)
+
+// User is the account the issuer vouches for
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// Issuer is a running fake identity provider
+type Issuer struct {
+	*httptest.Server
+	ClientID string
+
+	// User is who the next authorization signs in as
+	User User
+	// ModifyIDToken, when set, changes ID token claims before they're signed
+	ModifyIDToken func(claims jwt.MapClaims)
+	// SignWith, when set, signs ID tokens with a key other than the published one
+	SignWith *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+	tokens map[string]User
+}
+
+// grant is an issued authorization code
+type grant struct {
+	user        User
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// NewIssuer starts an issuer that accepts the given client and stops it when
+// the test ends
+func NewIssuer(tb testing.TB, clientID string) *Issuer {
+	tb.Helper()
+
+	keyOnce.Do(func() {
+		var err error
+		if signingKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+	})
+
+	iss := &Issuer{
+		ClientID: clientID,
+		grants:   map[string]grant{},
+		tokens:   map[string]User{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/authorize", iss.authorize)
+	mux.HandleFunc("/token", iss.token)
+	mux.HandleFunc("/userinfo", iss.userInfo)
+	mux.HandleFunc("/jwks", iss.jwks)
+
+	iss.Server = httptest.NewServer(mux)
+	tb.Cleanup(iss.Close)
+	return iss
+}
+
+// Authorize plays the browser at the issuer's sign in page: it follows
+// authURL as the current User and returns the callback URL the issuer
+// redirects back to
+func (iss *Issuer) Authorize(tb testing.TB, authURL string) *url.URL {
+	tb.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		tb.Fatalf("authorize: status %d without redirect", resp.StatusCode)
+	}
+	return location
+}
+
+func (iss *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 iss.URL,
+		"authorization_endpoint": iss.URL + "/authorize",
+		"token_endpoint":         iss.URL + "/token",
+		"userinfo_endpoint":      iss.URL + "/userinfo",
+		"jwks_uri":               iss.URL + "/jwks",
+	})
+}
+
+func (iss *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != iss.ClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	iss.mu.Lock()
+	iss.grants[code] = grant{
+		user:        iss.User,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	iss.mu.Unlock()
+
+	callback, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := url.Values{"code": {code}, "state": {q.Get("state")}}
+	callback.RawQuery = params.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (iss *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+	}
+
+	code := r.PostFormValue("code")
+	iss.mu.Lock()
+	g, found := iss.grants[code]
+	delete(iss.grants, code)
+	iss.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found || clientID != iss.ClientID ||
+		r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   iss.URL,
+		"aud":   iss.ClientID,
+		"sub":   g.user.Subject,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	if iss.ModifyIDToken != nil {
+		iss.ModifyIDToken(claims)
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = keyID
+	key := signingKey
+	if iss.SignWith != nil {
+		key = iss.SignWith
+	}
+	signed, err := idToken.SignedString(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken := randomString()
+	iss.mu.Lock()
+	iss.tokens[accessToken] = g.user
+	iss.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (iss *Issuer) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	iss.mu.Lock()
+	user, ok := iss.tokens[accessToken]
+	iss.mu.Unlock()
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"given_name":     user.GivenName,
+		"family_name":    user.FamilyName,
+	})
+}
+
+func (iss *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	enc := base64.RawURLEncoding
+	pub := signingKey.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   enc.EncodeToString(pub.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,192 @@
+// Package policy decides who may see and act on posts and the comments and
+// likes under them. Handlers ask it before touching a post or its children
+// and use its query scopes for lists, so the rules (visibility, hidden
+// content, blocks and deleted authors) are written down in one place.
+package policy
+
+import (
+	"net/http"
+
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+)
+
+// Viewer is the user a decision is made for
+type Viewer struct {
+	ID   uint
+	Role string
+}
+
+func (v Viewer) can(perm auth.Permission) bool {
+	return auth.HasPermission(v.Role, perm)
+}
+
+// Action is something a user does to a post or a comment
+type Action string
+
+const (
+	// View covers reading a post or comment and the comments, replies and
+	// likes under it
+	View Action = "view"
+	// Comment covers commenting on a post and replying to a comment
+	Comment Action = "comment"
+	// Like covers liking and unliking
+	Like   Action = "like"
+	Update Action = "update"
+	Delete Action = "delete"
+	// Moderate covers hiding and unhiding
+	Moderate Action = "moderate"
+)
+
+// Denial is returned when an action is refused. It carries the response
+// the API gives for it.
+type Denial struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (d *Denial) Error() string {
+	return d.Message
+}
+
+func notFound(message string) *Denial {
+	return &Denial{Status: http.StatusNotFound, Code: "not_found", Message: message}
+}
+
+func forbidden(message string) *Denial {
+	return &Denial{Status: http.StatusForbidden, Code: "forbidden", Message: message}
+}
+
+var errBlocked = &Denial{Status: http.StatusForbidden, Code: "blocked", Message: "You can't interact with this user"}
+
+// AuthorizePost decides whether the viewer may perform action on post. It
+// returns nil when they may and a *Denial when they may not.
+func AuthorizePost(v Viewer, action Action, post *models.Post) error {
+	switch action {
+	case Update:
+		if post.UserID != v.ID {
+			return forbidden("You can only update your own posts")
+		}
+		return nil
+	case Delete:
+		// Authors can always remove what they wrote
+		if post.UserID != v.ID && !v.can(auth.PermModeratePosts) {
+			return forbidden("You can only delete your own posts")
+		}
+		return nil
+	case Moderate:
+		if !v.can(auth.PermModeratePosts) {
+			return forbidden("You don't have permission to do this")
+		}
+		return nil
+	}
+
+	return viewPost(v, action, post)
+}
+
+// AuthorizeComment decides whether the viewer may perform action on a
+// comment of post. Anything but deleting needs the post to be visible to
+// the viewer, and neither the post's nor the comment's author to be on the
+// other side of a block.
+func AuthorizeComment(v Viewer, action Action, post *models.Post, comment *models.Comment) error {
+	switch action {
+	case Delete:
+		if comment.UserID != v.ID && !v.can(auth.PermModerateComments) {
+			return forbidden("You can only delete your own comments")
+		}
+		return nil
+	case Moderate:
+		if !v.can(auth.PermModerateComments) {
+			return forbidden("You don't have permission to do this")
+		}
+		return nil
+	}
+
+	if err := viewPost(v, action, post); err != nil {
+		return err
+	}
+	if comment.HiddenAt != nil && comment.UserID != v.ID && !v.can(auth.PermModerateComments) {
+		return notFound("Comment not found")
+	}
+	blocked, err := IsBlocked(v.ID, comment.UserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		if action == View {
+			return notFound("Comment not found")
+		}
+		return errBlocked
+	}
+	return nil
+}
+
+// viewPost decides whether the viewer may see post, and so act on it.
+// Deleted posts, posts whose author deleted their account, hidden posts and
+// posts outside the viewer's audience look like they don't exist, as do
+// posts of users on the other side of a block unless the viewer is trying
+// to interact with them. Errors that aren't a *Denial mean the decision
+// couldn't be made.
+func viewPost(v Viewer, action Action, post *models.Post) error {
+	if post.DeletedAt.Valid {
+		return notFound("Post not found")
+	}
+	if post.UserID == v.ID {
+		return nil
+	}
+	if post.HiddenAt != nil && !v.can(auth.PermModeratePosts) {
+		return notFound("Post not found")
+	}
+
+	var author int64
+	if err := database.DB.Model(&models.User{}).Where("id = ?", post.UserID).Count(&author).Error; err != nil {
+		return err
+	}
+	if author == 0 {
+		return notFound("Post not found")
+	}
+
+	blocked, err := IsBlocked(v.ID, post.UserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		if action == View {
+			return notFound("Post not found")
+		}
+		return errBlocked
+	}
+
+	inAudience, err := canViewPost(v.ID, post)
+	if err != nil {
+		return err
+	}
+	if !inAudience {
+		return notFound("Post not found")
+	}
+	return nil
+}
+
+// canViewPost reports whether the viewer is in a post's audience
+func canViewPost(viewerID uint, post *models.Post) (bool, error) {
+	if post.UserID == viewerID || post.Visibility == models.VisibilityPublic {
+		return true, nil
+	}
+
+	var count int64
+	err := visible(database.DB.Unscoped().Model(&models.Post{}), viewerID).
+		Where("posts.id = ?", post.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlocked reports whether either user blocked the other
+func IsBlocked(a, b uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"github.com/applifylab/social-feed-backend/internal/auth"
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Posts limits a posts query to the posts the viewer may see, following the
+// same rules as AuthorizePost
+func Posts(query *gorm.DB, v Viewer) *gorm.DB {
+	query = visible(query, v.ID)
+	if !v.can(auth.PermModeratePosts) {
+		query = query.Where("posts.hidden_at IS NULL OR posts.user_id = ?", v.ID)
+	}
+	query = WithoutDeletedUsers(query, "posts.user_id")
+	return withoutBlocked(query, v.ID, "posts.user_id")
+}
+
+// Comments limits a comments query to the comments the viewer may see. The
+// post they belong to is checked with AuthorizePost.
+func Comments(query *gorm.DB, v Viewer) *gorm.DB {
+	if !v.can(auth.PermModerateComments) {
+		query = query.Where("comments.hidden_at IS NULL OR comments.user_id = ?", v.ID)
+	}
+	query = WithoutDeletedUsers(query, "comments.user_id")
+	return withoutBlocked(query, v.ID, "comments.user_id")
+}
+
+// Likes limits a likes query to the likes the viewer may see. The post or
+// comment they belong to is checked with AuthorizePost or AuthorizeComment.
+func Likes(query *gorm.DB, v Viewer) *gorm.DB {
+	query = WithoutDeletedUsers(query, "likes.user_id")
+	return withoutBlocked(query, v.ID, "likes.user_id")
+}
+
+// WithoutDeletedUsers leaves out rows whose user, in column, deleted their
+// account and is within the grace period. Purged accounts are kept as
+// anonymized users, so what remains of their threads stays visible.
+func WithoutDeletedUsers(query *gorm.DB, column string) *gorm.DB {
+	deleted := database.DB.Unscoped().Model(&models.User{}).
+		Select("id").
+		Where("deleted_at IS NOT NULL")
+	return query.Where(column+" NOT IN (?)", deleted)
+}
+
+// visible limits a posts query to the posts whose audience includes the
+// viewer. It is the only place the visibility rules are written down.
+func visible(query *gorm.DB, viewerID uint) *gorm.DB {
+	return query.Where(`(posts.user_id = ?
+		OR posts.visibility = ?
+		OR (posts.visibility = ? AND EXISTS (SELECT 1 FROM follows WHERE follows.followee_id = posts.user_id AND follows.follower_id = ?))
+		OR (posts.visibility = ? AND EXISTS (SELECT 1 FROM close_friends WHERE close_friends.user_id = posts.user_id AND close_friends.friend_id = ?))
+		OR (posts.visibility = ? AND EXISTS (SELECT 1 FROM post_audiences WHERE post_audiences.post_id = posts.id AND post_audiences.user_id = ?)))`,
+		viewerID,
+		models.VisibilityPublic,
+		models.VisibilityFollowers, viewerID,
+		models.VisibilityCloseFriends, viewerID,
+		models.VisibilitySpecific, viewerID)
+}
+
+// withoutBlocked leaves out rows whose user, in column, the viewer blocked
+// or was blocked by
+func withoutBlocked(query *gorm.DB, viewerID uint, column string) *gorm.DB {
+	blocked := database.DB.Model(&models.Block{}).Select("blocked_id").Where("blocker_id = ?", viewerID)
+	blockers := database.DB.Model(&models.Block{}).Select("blocker_id").Where("blocked_id = ?", viewerID)
+	return query.Where(column+" NOT IN (?) AND "+column+" NOT IN (?)", blocked, blockers)
+}
@@ -0,0 +1,80 @@
+// Package testdb gives tests a freshly migrated database. It is an in-memory
+// SQLite database unless TEST_DATABASE_URL points at a Postgres server, in
+// which case each test gets a schema of its own that is dropped afterwards.
+package testdb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open points database.DB at a new, migrated database for the test and
+// returns it
+func Open(tb testing.TB) *gorm.DB {
+	tb.Helper()
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		tb.Fatal(err)
+	}
+	name := "test_" + hex.EncodeToString(suffix)
+
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	var db *gorm.DB
+	var err error
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		db, err = openPostgres(tb, url, name, config)
+	} else {
+		// A named shared-cache database, so every pooled connection sees
+		// the same data. Its errors are translated for
+		// database.IsUniqueViolation.
+		config.TranslateError = true
+		db, err = gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=foreign_keys(0)", name)), config)
+	}
+	if err != nil {
+		tb.Fatal("Failed to open test database:", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { sqlDB.Close() })
+
+	previous := database.DB
+	database.DB = db
+	tb.Cleanup(func() { database.DB = previous })
+
+	if err := database.AutoMigrate(); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func openPostgres(tb testing.TB, url, schema string, config *gorm.Config) (*gorm.DB, error) {
+	admin, err := gorm.Open(postgres.Open(url), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		return nil, err
+	}
+	tb.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return gorm.Open(postgres.Open(url+" search_path="+schema), config)
+}
@@ -0,0 +1,139 @@
+// Package timeline maintains the precomputed home timelines. A new post is
+// written to the timeline of every follower of its author (fan-out on write).
+// Posts of authors with more than FANOUT_MAX_FOLLOWERS followers are not,
+// they are merged in when a timeline is read instead (fan-out on read).
+package timeline
+
+import (
+	"github.com/applifylab/social-feed-backend/internal/database"
+	"github.com/applifylab/social-feed-backend/internal/models"
+	"github.com/applifylab/social-feed-backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// backfillPosts is how many of an author's recent posts are added to a
+// timeline when the author is followed
+const backfillPosts = 100
+
+// FanOut writes a post to the timelines of its author and their followers
+// and marks it as fanned out. Posts only the author can see and posts by
+// authors with more than maxFollowers followers are left to be read from the
+// posts table. Entries are written regardless of the post's audience, which
+// is checked when the timeline is read.
+func FanOut(post *models.Post, maxFollowers int) error {
+	if post.Visibility == models.VisibilityOnlyMe {
+		return nil
+	}
+
+	var followers int64
+	if err := database.DB.Model(&models.Follow{}).Where("followee_id = ?", post.UserID).Count(&followers).Error; err != nil {
+		return err
+	}
+	if followers > int64(maxFollowers) {
+		return nil
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// One statement, so the entries never pass through the application
+		if err := tx.Exec(`
+			INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+			SELECT follows.follower_id, posts.id, posts.user_id, posts.created_at
+			FROM posts JOIN follows ON follows.followee_id = posts.user_id
+			WHERE posts.id = ?
+			UNION ALL
+			SELECT posts.user_id, posts.id, posts.user_id, posts.created_at
+			FROM posts WHERE posts.id = ?
+			ON CONFLICT DO NOTHING`,
+			post.ID, post.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(post).UpdateColumn("fanned_out", true).Error
+	})
+}
+
+// AddAuthor puts the recent fanned out posts of an author on a follower's
+// timeline. Posts that weren't fanned out are read from the posts table.
+func AddAuthor(followerID, authorID uint) error {
+	recent := database.DB.Model(&models.Post{}).
+		Select("id").
+		Where("user_id = ? AND fanned_out", authorID).
+		Order("created_at DESC").
+		Limit(backfillPosts)
+
+	return database.DB.Exec(`
+		INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+		SELECT follows.follower_id, posts.id, posts.user_id, posts.created_at
+		FROM posts JOIN follows ON follows.followee_id = posts.user_id
+		WHERE follows.follower_id = ? AND posts.id IN (?)
+		ON CONFLICT DO NOTHING`,
+		followerID, recent).Error
+}
+
+// RemoveAuthor takes an author's posts off a follower's timeline
+func RemoveAuthor(followerID, authorID uint) error {
+	return database.DB.Where("user_id = ? AND author_id = ?", followerID, authorID).
+		Delete(&models.TimelineEntry{}).Error
+}
+
+// RemovePosts takes posts off every timeline
+func RemovePosts(tx *gorm.DB, postIDs ...uint) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	return tx.Where("post_id IN ?", postIDs).Delete(&models.TimelineEntry{}).Error
+}
+
+// Home reads a page of a user's home timeline, newest first. The posts
+// fanned out to them are read in order from their timeline entries; the
+// posts of followed authors and their own that weren't fanned out come from
+// the posts table, and the two are merged. scope applies the visibility
+// rules and anything else the caller needs, such as preloads, to both posts
+// queries. Like Page.Apply, one post more than the limit is returned.
+func Home(userID uint, page utils.Page, scope func(*gorm.DB) *gorm.DB) ([]models.Post, error) {
+	var pushed []models.Post
+	query := scope(database.DB.Model(&models.Post{}).
+		Select("posts.*").
+		Joins("JOIN timeline_entries ON timeline_entries.post_id = posts.id").
+		Where("timeline_entries.user_id = ?", userID))
+	if err := page.ApplyColumns(query, "timeline_entries.created_at", "timeline_entries.post_id", false).
+		Find(&pushed).Error; err != nil {
+		return nil, err
+	}
+
+	// Only popular authors' posts aren't fanned out. Starting from those,
+	// through the partial index, and checking each author is followed reads
+	// far fewer rows than going through everyone the user follows.
+	var pulled []models.Post
+	query = scope(database.DB.Model(&models.Post{}).
+		Where(`posts.fanned_out = false AND (posts.user_id = ?
+			OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = ? AND follows.followee_id = posts.user_id))`,
+			userID, userID))
+	if err := page.Apply(query, "posts", false).Find(&pulled).Error; err != nil {
+		return nil, err
+	}
+
+	return merge(pushed, pulled, page.Limit+1), nil
+}
+
+// merge combines two lists of posts ordered newest first into one of at
+// most limit posts. A post is either fanned out or not, so the lists never
+// share one.
+func merge(a, b []models.Post, limit int) []models.Post {
+	posts := make([]models.Post, 0, min(len(a)+len(b), limit))
+	for len(posts) < limit && (len(a) > 0 || len(b) > 0) {
+		if len(b) == 0 || (len(a) > 0 && newer(&a[0], &b[0])) {
+			posts, a = append(posts, a[0]), a[1:]
+		} else {
+			posts, b = append(posts, b[0]), b[1:]
+		}
+	}
+	return posts
+}
+
+// newer reports whether p comes before q in a timeline
+func newer(p, q *models.Post) bool {
+	if !p.CreatedAt.Equal(q.CreatedAt) {
+		return p.CreatedAt.After(q.CreatedAt)
+	}
+	return p.ID > q.ID
+}
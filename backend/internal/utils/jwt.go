@@ -5,34 +5,44 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// TokenPurposeMFAPending marks a token that only proves the password step of
+// a two-factor login. It is not accepted as an access token.
+const TokenPurposeMFAPending = "mfa_pending"
+
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID        uint   `json:"user_id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          string `json:"role,omitempty"`
+	SessionID     uint   `json:"sid,omitempty"`
+	TokenVersion  int    `json:"ver"`
+	Purpose       string `json:"purpose,omitempty"`
+
+	// Set on tokens an admin uses to act as UserID. Read-only tokens may
+	// only make GET requests.
+	ImpersonatorID uint `json:"impersonator_id,omitempty"`
+	ReadOnly       bool `json:"read_only,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID uint, email, secret string) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+// GenerateToken signs the given claims as an access token valid for ttl.
+// Every token gets a unique ID (jti) so it can be revoked individually.
+func GenerateToken(claims *Claims, keys *KeySet, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.ID = uuid.NewString()
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.IssuedAt = jwt.NewNumericDate(now)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(claims)
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func ValidateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+// ValidateToken validates a JWT token against the key set and returns the claims
+func ValidateToken(tokenString string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.keyFunc)
 
 	if err != nil {
 		return nil, err
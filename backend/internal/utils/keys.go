@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a key tokens are signed or verified with
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private is nil for verification-only keys
+	Private interface{}
+	// Public is the verification key; for HMAC it's the shared secret
+	Public interface{}
+}
+
+// KeySet holds the active signing key and every key accepted for
+// verification, looked up by the token's kid header
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// JWK is the JSON Web Key representation of a public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// NewHMACKeySet returns a key set signing and verifying with a shared secret
+func NewHMACKeySet(secret string) *KeySet {
+	key := &Key{ID: "hs256", Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}
+	return &KeySet{active: key, keys: map[string]*Key{key.ID: key}}
+}
+
+// LoadKeySet reads a PEM private key to sign with (RS256 or EdDSA, depending
+// on the key type) and any number of extra PEM public keys that are still
+// accepted, e.g. the previous key during a rotation
+func LoadKeySet(privateKeyFile string, verifyKeyFiles []string) (*KeySet, error) {
+	active, err := loadKeyFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("%s does not contain a private key", privateKeyFile)
+	}
+
+	set := &KeySet{active: active, keys: map[string]*Key{active.ID: active}}
+	for _, file := range verifyKeyFiles {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+// Algorithm returns the algorithm new tokens are signed with
+func (s *KeySet) Algorithm() string {
+	return s.active.Method.Alg()
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.Private)
+}
+
+// keyFunc picks the verification key named by the token's kid header and
+// makes sure the token uses that key's algorithm
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := s.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = s.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys for /.well-known/jwks.json. Shared secrets are
+// never published.
+func (s *KeySet) JWKS() []JWK {
+	keys := []JWK{}
+	for _, key := range s.keys {
+		if jwk, ok := publicJWK(key); ok {
+			keys = append(keys, jwk)
+		}
+	}
+
+	// Active key first, the rest in a stable order
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i].Kid == s.active.ID) != (keys[j].Kid == s.active.ID) {
+			return keys[i].Kid == s.active.ID
+		}
+		return keys[i].Kid < keys[j].Kid
+	})
+	return keys
+}
+
+// loadKeyFile parses a PEM file holding a private or public RSA or Ed25519 key
+func loadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	key := &Key{}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Private = signer
+		parsed = signer.Public()
+	}
+
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+		key.Public = pub
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.Public = pub
+	default:
+		return nil, fmt.Errorf("unsupported key type %T in %s", parsed, path)
+	}
+
+	jwk, _ := publicJWK(key)
+	key.ID, err = thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// publicJWK describes the public half of an asymmetric key
+func publicJWK(key *Key) (JWK, bool) {
+	enc := base64.RawURLEncoding
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Kid: key.ID, Use: "sig", Alg: AlgRS256,
+			N: enc.EncodeToString(pub.N.Bytes()),
+			E: enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP", Kid: key.ID, Use: "sig", Alg: AlgEdDSA,
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(pub),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// thumbprint computes the RFC 7638 thumbprint used as the key ID
+func thumbprint(jwk JWK) (string, error) {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", errors.New("unsupported key type")
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
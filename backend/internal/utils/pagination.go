@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MaxPageLimit is the most items a list endpoint returns at once
+const MaxPageLimit = 100
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position after which the next page of a list starts. Lists
+// are ordered by creation time with the ID breaking ties, so a cursor stays
+// valid while items are added.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// Encode turns the cursor into the opaque string handed to clients
+func (cur Cursor) Encode() string {
+	raw := cur.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatUint(uint64(cur.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor made by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	var cur Cursor
+	if cur.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, errInvalidCursor
+	}
+	n, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	cur.ID = uint(n)
+	return &cur, nil
+}
+
+// Page is the part of a list a request asks for: up to Limit items after
+// Cursor, or from the start when Cursor is nil
+type Page struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// ParsePage reads the limit and cursor query parameters. The limit falls
+// back to defaultLimit and is clamped to MaxPageLimit. It responds with 400
+// and returns false for a cursor it didn't issue.
+func ParsePage(c *gin.Context, defaultLimit int) (Page, bool) {
+	page := Page{Limit: defaultLimit}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		page.Limit = min(limit, MaxPageLimit)
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		cur, err := DecodeCursor(s)
+		if err != nil {
+			ErrorResponse(c, http.StatusBadRequest, "invalid_cursor", "Invalid cursor")
+			return page, false
+		}
+		page.Cursor = cur
+	}
+	return page, true
+}
+
+// Apply orders query by the created_at and id columns of table, newest
+// first or oldest first when ascending, and restricts it to the page. One
+// row more than the limit is fetched so Next can tell if there are more.
+func (p Page) Apply(query *gorm.DB, table string, ascending bool) *gorm.DB {
+	return p.ApplyColumns(query, table+".created_at", table+".id", ascending)
+}
+
+// ApplyColumns is Apply for lists ordered by other columns, such as the
+// post_id of a timeline entry standing in for the post's id
+func (p Page) ApplyColumns(query *gorm.DB, createdAtColumn, idColumn string, ascending bool) *gorm.DB {
+	op, dir := "<", "DESC"
+	if ascending {
+		op, dir = ">", "ASC"
+	}
+
+	if p.Cursor != nil {
+		query = query.Where("("+createdAtColumn+", "+idColumn+") "+op+" (?, ?)", p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	return query.
+		Order(createdAtColumn + " " + dir).
+		Order(idColumn + " " + dir).
+		Limit(p.Limit + 1)
+}
+
+// NextPage drops the extra row fetched by Page.Apply and returns the cursor
+// of the page after items, or "" if this is the last page. key returns the
+// creation time and ID of an item.
+func NextPage[T any](items []T, page Page, key func(*T) (time.Time, uint)) ([]T, string) {
+	if len(items) <= page.Limit {
+		return items, ""
+	}
+
+	items = items[:page.Limit]
+	createdAt, id := key(&items[len(items)-1])
+	return items, Cursor{CreatedAt: createdAt, ID: id}.Encode()
+}
@@ -13,13 +13,14 @@ type Response struct {
 	Message string      `json:"message,omitempty"`
 }
 
+// PaginatedResponse is one page of a list. Pass NextCursor as the cursor
+// query parameter to get the next page; it is empty on the last page.
 type PaginatedResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data"`
-	Page    int         `json:"page"`
-	Limit   int         `json:"limit"`
-	Total   int64       `json:"total"`
-	HasMore bool        `json:"has_more"`
+	Success    bool        `json:"success"`
+	Data       interface{} `json:"data"`
+	Limit      int         `json:"limit"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 // SuccessResponse sends a successful JSON response
@@ -40,15 +41,14 @@ func ErrorResponse(c *gin.Context, statusCode int, err string, message string) {
 	})
 }
 
-// PaginatedSuccessResponse sends a paginated successful JSON response
-func PaginatedSuccessResponse(c *gin.Context, data interface{}, page, limit int, total int64) {
-	hasMore := int64(page*limit) < total
+// PaginatedSuccessResponse sends a page of a list, with the cursor of the
+// next page returned by NextPage
+func PaginatedSuccessResponse(c *gin.Context, data interface{}, limit int, nextCursor string) {
 	c.JSON(http.StatusOK, PaginatedResponse{
-		Success: true,
-		Data:    data,
-		Page:    page,
-		Limit:   limit,
-		Total:   total,
-		HasMore: hasMore,
+		Success:    true,
+		Data:       data,
+		Limit:      limit,
+		HasMore:    nextCursor != "",
+		NextCursor: nextCursor,
 	})
 }
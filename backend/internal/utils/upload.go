@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// uploadURLPrefix is where uploaded files are served from
+const uploadURLPrefix = "/uploads/"
+
+// UploadPath returns the file an image URL returned by the upload endpoint
+// points to, or false for URLs that don't refer to an upload
+func UploadPath(uploadDir, imageURL string) (string, bool) {
+	if !strings.HasPrefix(imageURL, uploadURLPrefix) {
+		return "", false
+	}
+
+	filename := path.Base(imageURL)
+	if filename != imageURL[len(uploadURLPrefix):] || filename == "." || filename == ".." {
+		return "", false
+	}
+	return filepath.Join(uploadDir, filename), true
+}
@@ -44,7 +44,7 @@ export default function CreatePostBox({ onPostCreated }) {
             const newPost = await createPost({
                 content: postContent,
                 image_url: imageUrl,
-                is_private: false
+                visibility: 'public'
             });
 
             // Clear form
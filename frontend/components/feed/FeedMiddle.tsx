@@ -12,7 +12,7 @@ export default function FeedMiddle() {
     const fetchPosts = async () => {
         try {
             setLoading(true);
-            const response = await getPosts(1, 20); // Fetch first page for now
+            const response = await getPosts(20); // Fetch first page for now
             setPosts(response.data || []);
         } catch (err) {
             console.error('Failed to fetch posts:', err);
@@ -1,6 +1,14 @@
 import { useState, useEffect } from 'react';
 import { togglePostLike, createComment, getComments, deletePost, deleteComment, toggleCommentLike, getImageUrl } from '@/lib/api';
 
+const VISIBILITY_LABELS = {
+    public: 'Public',
+    followers: 'Followers',
+    close_friends: 'Close friends',
+    specific: 'Specific people',
+    only_me: 'Only me',
+};
+
 export default function TimelinePost({ post: initialPost }) {
     const [post, setPost] = useState(initialPost);
     const [showDropdown, setShowDropdown] = useState(false);
@@ -155,7 +163,7 @@ export default function TimelinePost({ post: initialPost }) {
                                 {post.user.first_name} {post.user.last_name}
                             </h4>
                             <p className="_feed_inner_timeline_post_box_para">
-                                {formatDate(post.created_at)} . <a href="#0">{post.is_private ? 'Private' : 'Public'}</a>
+                                {formatDate(post.created_at)} . <a href="#0">{VISIBILITY_LABELS[post.visibility] || 'Public'}</a>
                             </p>
                         </div>
                     </div>
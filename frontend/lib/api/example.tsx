@@ -16,7 +16,7 @@ export default function FeedExample() {
     const loadPosts = async () => {
         try {
             setLoading(true);
-            const response = await getPosts(1, 20);
+            const response = await getPosts(20);
             setPosts(response.data);
         } catch (error) {
             console.error('Failed to load posts:', error);
@@ -30,7 +30,7 @@ export default function FeedExample() {
         try {
             const newPost = await createPost({
                 content,
-                is_private: false,
+                visibility: 'public',
             });
             setPosts([newPost, ...posts]);
         } catch (error) {
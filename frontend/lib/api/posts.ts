@@ -1,11 +1,13 @@
 import apiClient from './client';
 import { User } from './auth';
 
+export type Visibility = 'public' | 'followers' | 'close_friends' | 'specific' | 'only_me';
+
 export interface Post {
     id: number;
     content: string;
     image_url?: string;
-    is_private: boolean;
+    visibility: Visibility;
     created_at: string;
     updated_at: string;
     user: User;
@@ -17,20 +19,22 @@ export interface Post {
 export interface CreatePostData {
     content: string;
     image_url?: string;
-    is_private?: boolean;
+    visibility?: Visibility;
+    audience?: string[];
 }
 
 export interface UpdatePostData {
     content?: string;
-    is_private?: boolean;
+    visibility?: Visibility;
+    audience?: string[];
 }
 
 export interface PaginatedResponse<T> {
     data: T[];
-    page: number;
     limit: number;
-    total: number;
     has_more: boolean;
+    // Pass back as the cursor to get the next page; absent on the last page
+    next_cursor?: string;
 }
 
 /**
@@ -42,11 +46,11 @@ export const createPost = async (data: CreatePostData): Promise<Post> => {
 };
 
 /**
- * Get all posts with pagination
+ * Get posts, newest first. Pass the next_cursor of a page to get the one after it.
  */
-export const getPosts = async (page: number = 1, limit: number = 20): Promise<PaginatedResponse<Post>> => {
+export const getPosts = async (limit: number = 20, cursor?: string): Promise<PaginatedResponse<Post>> => {
     const response = await apiClient.get('/posts', {
-        params: { page, limit },
+        params: { limit, cursor },
     });
     return response as any;
 };